@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+var errAuditFailed = errors.New("security audit found failing profiles or services")
+
+// securityAuditConfig selects the rules to run, rules missing from the file stay enabled
+type securityAuditConfig struct {
+	Rules map[string]bool `json:"rules"`
+	// ResidentialServices are glob patterns matched against the Service Profile name
+	ResidentialServices []string `json:"residentialServices"`
+}
+
+func defaultSecurityAuditConfig() *securityAuditConfig {
+	return &securityAuditConfig{
+		Rules:               map[string]bool{},
+		ResidentialServices: []string{"*res*", "*Res*", "*RES*"},
+	}
+}
+
+func (c *securityAuditConfig) enabled(id string) bool {
+	on, ok := c.Rules[id]
+	return !ok || on
+}
+
+func (c *securityAuditConfig) isResidential(name string) bool {
+	for _, pattern := range c.ResidentialServices {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSecurityAuditConfig reads the rules file, or ~/.config/ponpro/audit-security.json when it exists
+func loadSecurityAuditConfig(path string) (*securityAuditConfig, error) {
+	c := defaultSecurityAuditConfig()
+	if path == "" {
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return c, nil
+		}
+		path = filepath.Join(base, "ponpro", "audit-security.json")
+		if _, err = os.Stat(path); err != nil {
+			return c, nil
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if c.Rules == nil {
+		c.Rules = map[string]bool{}
+	}
+	return c, nil
+}
+
+// securityAuditRule checks either a Security Profile or a Service Profile with its Security Profile,
+// returning an empty message when the rule passes and ok false when it does not apply
+type securityAuditRule struct {
+	ID           string
+	Description  string
+	checkProfile func(c *securityAuditConfig, secp *gopon.SecurityProfile) (msg string, ok bool)
+	checkService func(c *securityAuditConfig, sp *gopon.ServiceProfile, secp *gopon.SecurityProfile) (msg string, ok bool)
+}
+
+var securityAuditRules = []*securityAuditRule{
+	{
+		ID:          "storm-control-residential",
+		Description: "Storm control is not disabled (-1) on residential services",
+		checkService: func(c *securityAuditConfig, sp *gopon.ServiceProfile, secp *gopon.SecurityProfile) (string, bool) {
+			if !c.isResidential(sp.Name) {
+				return "", false
+			}
+			if secp == nil {
+				return "residential service has no Security Profile, storm control is disabled", true
+			}
+			var disabled []string
+			for i, v := range secp.GetStormControl() {
+				if v == -1 {
+					disabled = append(disabled, gopon.SecStmCtlList[i])
+				}
+			}
+			if len(disabled) > 0 {
+				return fmt.Sprintf("storm control disabled for %s in Security Profile %s", strings.Join(disabled, ", "), secp.Name), true
+			}
+			return "", true
+		},
+	},
+	{
+		ID:          "arl-dhcp-set",
+		Description: "DHCP application rate limit is set",
+		checkProfile: func(c *securityAuditConfig, secp *gopon.SecurityProfile) (string, bool) {
+			if secp.AppRateLimitDhcp < 0 {
+				return "DHCP application rate limit is disabled (-1)", true
+			}
+			return "", true
+		},
+	},
+	{
+		ID:          "ipsg-requires-dhcp-ra",
+		Description: "IP Source-Guard is only used with the DHCP Relay Agent enabled on the same service",
+		checkService: func(c *securityAuditConfig, sp *gopon.ServiceProfile, secp *gopon.SecurityProfile) (string, bool) {
+			if secp == nil || (!secp.GetIPv4SG() && !secp.GetIPv6SG()) {
+				return "", false
+			}
+			var missing []string
+			if secp.GetIPv4SG() && sp.DhcpRa != 1 {
+				missing = append(missing, "IPv4 Source-Guard without DHCP RA")
+			}
+			if secp.GetIPv6SG() && sp.Dhcpv6Ra != 1 {
+				missing = append(missing, "IPv6 Source-Guard without DHCPv6 LDRA")
+			}
+			if len(missing) > 0 {
+				return fmt.Sprintf("%s, Security Profile %s has no bindings to check against", strings.Join(missing, ", "), secp.Name), true
+			}
+			return "", true
+		},
+	},
+	{
+		ID:          "mac-limit-port-security",
+		Description: "MAC limit is non-zero when port security is enabled",
+		checkProfile: func(c *securityAuditConfig, secp *gopon.SecurityProfile) (string, bool) {
+			if !secp.GetPortSecurity() {
+				return "", false
+			}
+			if secp.MacLimit == 0 {
+				return "port security is enabled with no MAC limit", true
+			}
+			return "", true
+		},
+	},
+}
+
+type auditResult struct {
+	Rule    string `json:"rule"`
+	Pass    bool   `json:"pass"`
+	Message string `json:"message,omitempty"`
+}
+
+// auditTarget is a profile or service with the results of the rules that apply to it
+type auditTarget struct {
+	Name            string         `json:"name"`
+	SecurityProfile string         `json:"securityProfile,omitempty"`
+	Pass            bool           `json:"pass"`
+	Results         []*auditResult `json:"results"`
+}
+
+func (t *auditTarget) add(rule, msg string) {
+	r := &auditResult{Rule: rule, Pass: msg == "", Message: msg}
+	t.Results = append(t.Results, r)
+	if !r.Pass {
+		t.Pass = false
+	}
+}
+
+func (t *auditTarget) failedRules() string {
+	var failed []string
+	for _, r := range t.Results {
+		if !r.Pass {
+			failed = append(failed, r.Rule)
+		}
+	}
+	if len(failed) == 0 {
+		return "-"
+	}
+	return strings.Join(failed, ",")
+}
+
+type securityAuditReport struct {
+	Olt      string         `json:"olt"`
+	Profiles []*auditTarget `json:"profiles"`
+	Services []*auditTarget `json:"services"`
+	Failures int            `json:"failures"`
+}
+
+// auditSecurity evaluates the enabled rules against every Security Profile and every Service Profile
+func auditSecurity(olt *gopon.LumiaOlt, c *securityAuditConfig) (*securityAuditReport, error) {
+	secpl, err := olt.GetSecurityProfiles()
+	if err != nil {
+		return nil, err
+	}
+	// copy the profiles, later requests re-use the memory the list points into
+	profiles := make(map[string]*gopon.SecurityProfile)
+	var names []string
+	for _, p := range secpl.Entry {
+		secp := *p
+		profiles[secp.Name] = &secp
+		names = append(names, secp.Name)
+	}
+	spl, err := olt.GetServiceProfiles()
+	if err != nil {
+		return nil, err
+	}
+	var services []gopon.ServiceProfile
+	for _, sp := range spl.Entry {
+		services = append(services, *sp)
+	}
+
+	report := &securityAuditReport{Olt: olt.Host}
+	for _, name := range names {
+		t := &auditTarget{Name: name, Pass: true}
+		for _, rule := range securityAuditRules {
+			if rule.checkProfile == nil || !c.enabled(rule.ID) {
+				continue
+			}
+			if msg, ok := rule.checkProfile(c, profiles[name]); ok {
+				t.add(rule.ID, msg)
+			}
+		}
+		report.Profiles = append(report.Profiles, t)
+	}
+	for i := range services {
+		sp := &services[i]
+		secp := profiles[sp.SecurityProfileName]
+		t := &auditTarget{Name: sp.Name, SecurityProfile: sp.SecurityProfileName, Pass: true}
+		for _, rule := range securityAuditRules {
+			if rule.checkService == nil || !c.enabled(rule.ID) {
+				continue
+			}
+			if msg, ok := rule.checkService(c, sp, secp); ok {
+				t.add(rule.ID, msg)
+			}
+		}
+		report.Services = append(report.Services, t)
+	}
+	for _, t := range append(report.Profiles, report.Services...) {
+		for _, r := range t.Results {
+			if !r.Pass {
+				report.Failures++
+			}
+		}
+	}
+	return report, nil
+}
+
+var SecurityAuditProfileHeaders = []string{
+	"Security Profile",
+	"Result",
+	"Failed Rules",
+}
+
+var SecurityAuditServiceHeaders = []string{
+	"Service Profile",
+	"Security Profile",
+	"Result",
+	"Failed Rules",
+}
+
+func passString(pass bool) string {
+	if pass {
+		return "PASS"
+	}
+	return "FAIL"
+}
+
+func writeSecurityAuditText(report *securityAuditReport) {
+	var rows [][]string
+	for _, t := range report.Profiles {
+		rows = append(rows, []string{t.Name, passString(t.Pass), t.failedRules()})
+	}
+	tabwriteTable("Security Profile Audit", SecurityAuditProfileHeaders, rows)
+	rows = nil
+	for _, t := range report.Services {
+		secpName := t.SecurityProfile
+		if secpName == "" {
+			secpName = "-"
+		}
+		rows = append(rows, []string{t.Name, secpName, passString(t.Pass), t.failedRules()})
+	}
+	tabwriteTable("Service Profile Audit", SecurityAuditServiceHeaders, rows)
+	for _, t := range append(report.Profiles, report.Services...) {
+		for _, r := range t.Results {
+			if !r.Pass {
+				fmt.Printf("!! %s [%s]: %s\n", t.Name, r.Rule, r.Message)
+			}
+		}
+	}
+	if report.Failures == 0 {
+		fmt.Println("++ All Security Profiles and services pass the audit")
+	}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitSuite has a test case per target and rule, so each failure is reported on its own
+func junitSuite(name, class string, targets []*auditTarget) *junitTestSuite {
+	s := &junitTestSuite{Name: name}
+	for _, t := range targets {
+		for _, r := range t.Results {
+			tc := &junitTestCase{ClassName: class + "." + t.Name, Name: r.Rule}
+			if !r.Pass {
+				tc.Failure = &junitFailure{Message: r.Message}
+				s.Failures++
+			}
+			s.Tests++
+			s.TestCases = append(s.TestCases, tc)
+		}
+	}
+	return s
+}
+
+// writeSecurityAuditJunit writes the reports as one document, the suites of a fleet run are named after their OLT
+func writeSecurityAuditJunit(w io.Writer, reports []*securityAuditReport) error {
+	suites := &junitTestSuites{Name: "ponpro audit security"}
+	for _, report := range reports {
+		name, class := "", ""
+		if len(reports) > 1 {
+			name, class = report.Olt+" ", report.Olt+"."
+		} else {
+			suites.Name += " " + report.Olt
+		}
+		suites.Suites = append(suites.Suites,
+			junitSuite(name+"Security Profiles", class+"securityProfile", report.Profiles),
+			junitSuite(name+"Service Profiles", class+"serviceProfile", report.Services),
+		)
+	}
+	for _, s := range suites.Suites {
+		suites.Tests += s.Tests
+		suites.Failures += s.Failures
+	}
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// writeSecurityAuditJson writes the report of a single OLT as an object, those of a fleet run as one array
+func writeSecurityAuditJson(w io.Writer, reports []*securityAuditReport) error {
+	var v interface{} = reports
+	if len(reports) == 1 {
+		v = reports[0]
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+var (
+	// auditReports are held until every OLT of the run is audited, so junit and json are written as one document
+	auditReports      []*securityAuditReport
+	auditReportFormat string
+)
+
+// flushAuditReports writes the junit or json reports held by auditSecurityCommand
+func flushAuditReports() error {
+	if len(auditReports) == 0 {
+		return nil
+	}
+	reports := auditReports
+	auditReports = nil
+	if auditReportFormat == "junit" {
+		return writeSecurityAuditJunit(reportWriter(), reports)
+	}
+	return writeSecurityAuditJson(reportWriter(), reports)
+}
+
+// auditSecurityCommand runs `audit security`, returning errAuditFailed when any rule fails so the exit status can be checked
+func auditSecurityCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("audit security", flag.ContinueOnError)
+	rulesFile := fs.String("rules", "", "JSON file enabling rules and naming residential services (default ~/.config/ponpro/audit-security.json)")
+	format := fs.String("format", "text", "Report format: text, junit or json")
+	fs.Usage = func() {
+		fmt.Println("audit security [-rules file] [-format text|junit|json]")
+		fs.PrintDefaults()
+		fmt.Println("Rules:")
+		for _, rule := range securityAuditRules {
+			fmt.Printf("  %s: %s\n", rule.ID, rule.Description)
+		}
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	// the junit and json reports are parsed by CI, nothing else may reach the writer they go to
+	switch strings.ToLower(*format) {
+	case "text":
+	case "junit", "json":
+		reportWriter()
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+	c, err := loadSecurityAuditConfig(*rulesFile)
+	if err != nil {
+		return err
+	}
+	report, err := auditSecurity(olt, c)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(*format) == "text" {
+		writeSecurityAuditText(report)
+	} else {
+		auditReportFormat = strings.ToLower(*format)
+		auditReports = append(auditReports, report)
+	}
+	if report.Failures > 0 {
+		return errAuditFailed
+	}
+	return nil
+}
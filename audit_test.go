@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+)
+
+func testAuditReports() []*securityAuditReport {
+	report := func(olt string, pass bool) *securityAuditReport {
+		r := &securityAuditReport{
+			Olt:      olt,
+			Profiles: []*auditTarget{{Name: "sec", Pass: pass, Results: []*auditResult{{Rule: "ip-source-guard", Pass: pass}}}},
+			Services: []*auditTarget{{Name: "hsi", Pass: true, Results: []*auditResult{{Rule: "security-profile", Pass: true}}}},
+		}
+		if !pass {
+			r.Failures = 1
+		}
+		return r
+	}
+	return []*securityAuditReport{report("10.0.0.1", true), report("10.0.0.2", false)}
+}
+
+func TestWriteSecurityAuditJunit(t *testing.T) {
+	var b bytes.Buffer
+	err := writeSecurityAuditJunit(&b, testAuditReports())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suites junitTestSuites
+	err = xml.Unmarshal(b.Bytes(), &suites)
+	if err != nil {
+		t.Fatalf("not one document: %v", err)
+	}
+	if suites.Tests != 4 || suites.Failures != 1 || len(suites.Suites) != 4 {
+		t.Errorf("%d tests, %d failures, %d suites, want 4, 1, 4", suites.Tests, suites.Failures, len(suites.Suites))
+	}
+	if len(suites.Suites) > 2 && suites.Suites[2].Name != "10.0.0.2 Security Profiles" {
+		t.Errorf("suite named %q", suites.Suites[2].Name)
+	}
+	b.Reset()
+	err = writeSecurityAuditJunit(&b, testAuditReports()[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	suites = junitTestSuites{}
+	err = xml.Unmarshal(b.Bytes(), &suites)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suites.Name != "ponpro audit security 10.0.0.1" || suites.Suites[0].Name != "Security Profiles" {
+		t.Errorf("single OLT report named %q, suite %q", suites.Name, suites.Suites[0].Name)
+	}
+}
+
+func TestWriteSecurityAuditJson(t *testing.T) {
+	var b bytes.Buffer
+	err := writeSecurityAuditJson(&b, testAuditReports())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []*securityAuditReport
+	err = json.Unmarshal(b.Bytes(), &reports)
+	if err != nil {
+		t.Fatalf("not one document: %v", err)
+	}
+	if len(reports) != 2 || reports[1].Olt != "10.0.0.2" || reports[1].Failures != 1 {
+		t.Errorf("got %+v", reports)
+	}
+	b.Reset()
+	err = writeSecurityAuditJson(&b, testAuditReports()[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report securityAuditReport
+	err = json.Unmarshal(b.Bytes(), &report)
+	if err != nil || report.Olt != "10.0.0.1" {
+		t.Errorf("single OLT report %+v: %v", report, err)
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// upstream line rates in kbps, the same unit used by the OnuTcontProfile data rates
+const (
+	gponUsCapacity   = 1244160
+	xgsponUsCapacity = 9953280
+)
+
+// onuTcontEntry is a single T-CONT as it is applied to an ONU through one of its Service Profiles
+type onuTcontEntry struct {
+	Interface    string
+	SerialNumber string
+	Service      string
+	VirtGemPort  int
+	Tcont        *gopon.OnuTcontProfile // nil if the Service Profile has no T-CONT Profile
+}
+
+// ponBudget is the sum of the T-CONT rates provisioned on a single PON port
+type ponBudget struct {
+	Port    string
+	Onus    int
+	Tconts  int
+	Fixed   int
+	Assured int
+	Max     int
+}
+
+var PonBudgetHeaders = []string{
+	"PON Port",
+	"ONUs",
+	"T-CONTs",
+	"Fixed",
+	"Assured",
+	"Fixed+Assured",
+	"Max",
+	"Capacity",
+	"Max Oversubscription",
+	"Status",
+}
+
+// ponUpstreamCapacity returns the upstream capacity of a PON port for the OLT technology in use
+func ponUpstreamCapacity() int {
+	if *xgsPon {
+		return xgsponUsCapacity
+	}
+	return gponUsCapacity
+}
+
+// ponPortFromIntf strips the ONU sub-interface from 0/x/y to return the PON port 0/x
+func ponPortFromIntf(intf string) string {
+	i := strings.LastIndex(intf, "/")
+	if i < 1 {
+		return intf
+	}
+	return intf[:i]
+}
+
+// formatKbps converts kbps values to Mbps and Gbps as applicable for display
+func formatKbps(n int) string {
+	switch {
+	case n >= 1000000:
+		return fmt.Sprintf("%.2fG", float64(n)/1000000)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fM", float64(n)/1000)
+	}
+	return fmt.Sprintf("%dk", n)
+}
+
+// getOnuTcontUsage resolves every ONU in the registry through its Service Profiles to the T-CONT Profiles applied to it
+// the T-CONT Profiles are also returned by name so callers can substitute a profile being edited
+func getOnuTcontUsage(olt *gopon.LumiaOlt) ([]*onuTcontEntry, map[string]*gopon.OnuTcontProfile, error) {
+	err := olt.UpdateOnuRegistry()
+	if err != nil {
+		return nil, nil, err
+	}
+	spl, err := olt.GetServiceProfiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	otpl, err := olt.GetOnuTcontProfiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	// the gopon lists point into a table that is re-used by the next request, keep copies instead
+	services := make(map[string]gopon.ServiceProfile)
+	for _, sp := range spl.Entry {
+		services[sp.Name] = *sp
+	}
+	tconts := make(map[string]*gopon.OnuTcontProfile)
+	for _, e := range otpl.Entry {
+		otp := *e
+		tconts[otp.Name] = &otp
+	}
+	var entries []*onuTcontEntry
+	for _, onu := range olt.Registration {
+		for _, s := range onu.Services {
+			sp, ok := services[s]
+			if !ok {
+				continue
+			}
+			entries = append(entries, &onuTcontEntry{
+				Interface:    onu.Interface,
+				SerialNumber: onu.SerialNumber,
+				Service:      s,
+				VirtGemPort:  sp.OnuVirtGemPortID,
+				Tcont:        tconts[sp.OnuTcontProfileName],
+			})
+		}
+	}
+	return entries, tconts, nil
+}
+
+// calculatePonBudgets sums the T-CONT rates of each PON port, sorted by port
+func calculatePonBudgets(entries []*onuTcontEntry) []*ponBudget {
+	budgets := make(map[string]*ponBudget)
+	onus := make(map[string]bool)
+	for _, e := range entries {
+		if e.Tcont == nil {
+			continue
+		}
+		port := ponPortFromIntf(e.Interface)
+		b, ok := budgets[port]
+		if !ok {
+			b = &ponBudget{Port: port}
+			budgets[port] = b
+		}
+		if !onus[e.Interface] {
+			onus[e.Interface] = true
+			b.Onus++
+		}
+		b.Tconts++
+		b.Fixed += e.Tcont.FixedDataRate
+		b.Assured += e.Tcont.AssuredDataRate
+		b.Max += e.Tcont.MaxDataRate
+	}
+	var list []*ponBudget
+	for _, b := range budgets {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Port < list[j].Port
+	})
+	return list
+}
+
+// IsOverBudget is true when the guaranteed (fixed + assured) rates cannot all be served by the port
+func (b *ponBudget) IsOverBudget(capacity int) bool {
+	return b.Fixed+b.Assured > capacity
+}
+
+func displayPonBandwidthBudget(olt *gopon.LumiaOlt) error {
+	entries, _, err := getOnuTcontUsage(olt)
+	if err != nil {
+		return err
+	}
+	capacity := ponUpstreamCapacity()
+	budgets := calculatePonBudgets(entries)
+	if len(budgets) == 0 {
+		fmt.Println("!! No ONU in the registry has a T-CONT Profile applied")
+		return nil
+	}
+	var rows [][]string
+	var over []string
+	for _, b := range budgets {
+		status := "OK"
+		if b.IsOverBudget(capacity) {
+			status = "OVER"
+			over = append(over, b.Port)
+		}
+		rows = append(rows, []string{
+			b.Port,
+			fmt.Sprintf("%d", b.Onus),
+			fmt.Sprintf("%d", b.Tconts),
+			formatKbps(b.Fixed),
+			formatKbps(b.Assured),
+			formatKbps(b.Fixed + b.Assured),
+			formatKbps(b.Max),
+			formatKbps(capacity),
+			fmt.Sprintf("%.2f:1", float64(b.Max)/float64(capacity)),
+			status,
+		})
+	}
+	tabwriteTable("PON Upstream Bandwidth Budget", PonBudgetHeaders, rows)
+	for _, port := range over {
+		fmt.Printf("!! PON Port %s: Fixed + Assured rates exceed the upstream capacity of %s\n", port, formatKbps(capacity))
+	}
+	return nil
+}
+
+// checkTcontBudget warns if replacing the T-CONT Profile origName with otp pushes any PON port over budget
+// returns false if the user chooses not to continue
+func checkTcontBudget(olt *gopon.LumiaOlt, origName string, otp *gopon.OnuTcontProfile) (bool, error) {
+	if otp.Name != origName {
+		// a renamed profile is posted as a new, unassigned copy, no ONU takes its rates
+		return true, nil
+	}
+	// fetching the T-CONT table again re-uses the memory the edited profile points into,
+	// so hold a copy of the edits and restore them once the usage has been gathered
+	edited := *otp
+	entries, _, err := getOnuTcontUsage(olt)
+	*otp = edited
+	if err != nil {
+		return false, err
+	}
+	capacity := ponUpstreamCapacity()
+	before := make(map[string]bool)
+	for _, b := range calculatePonBudgets(entries) {
+		before[b.Port] = b.IsOverBudget(capacity)
+	}
+	for _, e := range entries {
+		if e.Tcont != nil && e.Tcont.Name == origName {
+			e.Tcont = &edited
+		}
+	}
+	var warn bool
+	for _, b := range calculatePonBudgets(entries) {
+		if b.IsOverBudget(capacity) && !before[b.Port] {
+			fmt.Printf("!! This change pushes PON Port %s over budget: Fixed + Assured is %s of %s\n", b.Port, formatKbps(b.Fixed+b.Assured), formatKbps(capacity))
+			warn = true
+		}
+	}
+	if !warn {
+		return true, nil
+	}
+	fmt.Print(">> Post anyway? (y/N)\n>> ")
+	input := strings.ToLower(sanitizeInput(readFromStdin()))
+	return input == "y", nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// burst sizes of the Flow Profile policers are in kB (0...16384), 0 lets the OLT pick a default from the rate
+const (
+	burstSizeMax    = 16384
+	burstSizeMin    = 16
+	defaultBurstRtt = 50
+)
+
+var BurstHeaders = []string{
+	"Policer",
+	"Rate",
+	"RTT",
+	"Burst",
+	"Recommended",
+	"Full Bucket Lasts",
+}
+
+// recommendedBurstSize is the bandwidth-delay product of the rate over the round trip time in kB,
+// the amount a TCP sender can have in flight, kept within the settable range
+func recommendedBurstSize(rateKbps, rttMs int) int {
+	// kbps * ms = bits, / 8 = bytes, / 1000 = kB, rounded up
+	kB := (rateKbps*rttMs + 7999) / 8000
+	if kB < burstSizeMin {
+		kB = burstSizeMin
+	}
+	if kB > burstSizeMax {
+		kB = burstSizeMax
+	}
+	return kB
+}
+
+// bucketDuration is how long a full bucket carries traffic sent at twice the policed rate, in ms
+func bucketDuration(rateKbps, burstKB int) int {
+	if rateKbps == 0 {
+		return 0
+	}
+	return burstKB * 8000 / rateKbps
+}
+
+// burstWarnings flags combinations of rate and burst size that are likely to hurt TCP throughput
+func burstWarnings(name string, rateKbps, burstKB, rttMs int) []string {
+	var out []string
+	if rateKbps == 0 {
+		return out
+	}
+	bdp := (rateKbps*rttMs + 7999) / 8000
+	switch {
+	case burstKB == 0:
+		out = append(out, fmt.Sprintf("%s burst is 0, the OLT default for the rate is used, which may be smaller than the %d kB a TCP flow has in flight at %d ms RTT", name, bdp, rttMs))
+	case burstKB < 2:
+		out = append(out, fmt.Sprintf("%s burst of %d kB is smaller than a single full size frame, most frames will be dropped", name, burstKB))
+	case burstKB < bdp/2:
+		out = append(out, fmt.Sprintf("%s burst of %d kB is less than half of the %d kB bandwidth-delay product, TCP will back off repeatedly and run well below %s", name, burstKB, bdp, formatKbps(rateKbps)))
+	case burstKB > bdp*10 && burstKB > burstSizeMin*10:
+		out = append(out, fmt.Sprintf("%s burst of %d kB lets %d ms of traffic pass unpoliced, downstream buffers may overflow instead", name, burstKB, bucketDuration(rateKbps, burstKB)))
+	}
+	if bdp > burstSizeMax {
+		out = append(out, fmt.Sprintf("%s at %s needs %d kB at %d ms RTT, more than the largest burst of %d kB, long distance TCP flows will not reach the rate", name, formatKbps(rateKbps), bdp, rttMs, burstSizeMax))
+	}
+	return out
+}
+
+// burstPolicer is a rate and burst pair of a profile
+type burstPolicer struct {
+	Name  string
+	Rate  int
+	Burst int
+}
+
+func getBurstRtt() (int, error) {
+	fmt.Printf(">> Provide the target RTT or burst duration in ms to size the bucket for [%d]:\n>> ", defaultBurstRtt)
+	input := sanitizeInput(readFromStdin())
+	if input == "" {
+		return defaultBurstRtt, nil
+	}
+	rtt, err := strconv.Atoi(input)
+	if err != nil || rtt < 1 || rtt > 1000 {
+		return 0, gopon.ErrNotInput
+	}
+	return rtt, nil
+}
+
+// tabwriteBurstPolicers shows the recommendation of each policer, explains the token bucket and prints the warnings
+func tabwriteBurstPolicers(list []*burstPolicer, rttMs int) {
+	var rows [][]string
+	var warnings []string
+	for _, p := range list {
+		burst := "default"
+		if p.Burst > 0 {
+			burst = fmt.Sprintf("%d kB", p.Burst)
+		} else if p.Burst < 0 {
+			burst = "not settable"
+		}
+		rec := recommendedBurstSize(p.Rate, rttMs)
+		lasts := "-"
+		if p.Rate > 0 {
+			lasts = fmt.Sprintf("%d ms", bucketDuration(p.Rate, rec))
+		}
+		rows = append(rows, []string{p.Name, formatKbps(p.Rate), fmt.Sprintf("%d ms", rttMs), burst, fmt.Sprintf("%d kB", rec), lasts})
+		if p.Burst >= 0 {
+			warnings = append(warnings, burstWarnings(p.Name, p.Rate, p.Burst, rttMs)...)
+		} else {
+			warnings = append(warnings, burstWarnings(p.Name, p.Rate, rec, rttMs)...)
+		}
+	}
+	tabwriteTable("Burst Size Recommendation", BurstHeaders, rows)
+	fmt.Println("++ The policer is a token bucket the size of the burst, refilled at the rate. Frames pass while the bucket holds tokens, so a full bucket lets a burst through at line rate before traffic is held to the rate and the excess is dropped")
+	fmt.Println("++ A TCP flow has one round trip of data in flight, so a bucket smaller than rate x RTT drops part of every window and the flow backs off below the rate")
+	for _, w := range warnings {
+		fmt.Printf("!! %s\n", w)
+	}
+}
+
+// recommendBurstSize runs the calculator for a single policer, returning the size to set or the current one if declined
+func recommendBurstSize(name string, rateKbps, current int) (int, error) {
+	if rateKbps == 0 {
+		fmt.Printf("!! %s has no rate set, set the rate before sizing the burst\n", name)
+		return current, nil
+	}
+	rtt, err := getBurstRtt()
+	if err != nil {
+		return current, err
+	}
+	tabwriteBurstPolicers([]*burstPolicer{{Name: name, Rate: rateKbps, Burst: current}}, rtt)
+	rec := recommendedBurstSize(rateKbps, rtt)
+	fmt.Printf(">> Use the recommended %s of %d kB? (Y/n)\n>> ", name, rec)
+	input := strings.ToLower(sanitizeInput(readFromStdin()))
+	if input == "y" || input == "" {
+		return rec, nil
+	}
+	return current, nil
+}
+
+// checkOnuFlowProfileBursts reviews the ONU policers, which use the ONU default burst as the ONU Flow Profile has no burst size,
+// so the recommendation applies to the burst sizes of the Flow Profile carrying the same service
+func checkOnuFlowProfileBursts(ofp *gopon.OnuFlowProfile) error {
+	rtt, err := getBurstRtt()
+	if err != nil {
+		return err
+	}
+	tabwriteBurstPolicers([]*burstPolicer{
+		{Name: "UsCdr", Rate: ofp.UsCdr, Burst: -1},
+		{Name: "UsPdr", Rate: ofp.UsPdr, Burst: -1},
+	}, rtt)
+	fmt.Println("++ The ONU Flow Profile has no burst size, set the recommended values as UsCdrBurstSize and UsPdrBurstSize of the Flow Profile in the same Service Profile")
+	return nil
+}
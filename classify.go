@@ -0,0 +1,277 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// flowProfileSet holds copies of the Service Profiles and the Flow, ONU Flow and VLAN Profiles they reference, by name
+type flowProfileSet struct {
+	Services []*gopon.ServiceProfile
+	Flows    map[string]*gopon.FlowProfile
+	OnuFlows map[string]*gopon.OnuFlowProfile
+	Vlans    map[string]*gopon.VlanProfile
+}
+
+// getFlowProfileSet copies the profiles, as every request re-uses the memory the lists point into
+func getFlowProfileSet(olt *gopon.LumiaOlt) (*flowProfileSet, error) {
+	set := &flowProfileSet{
+		Flows:    make(map[string]*gopon.FlowProfile),
+		OnuFlows: make(map[string]*gopon.OnuFlowProfile),
+		Vlans:    make(map[string]*gopon.VlanProfile),
+	}
+	spl, err := olt.GetServiceProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range spl.Entry {
+		sp := *v
+		set.Services = append(set.Services, &sp)
+	}
+	fpl, err := olt.GetFlowProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range fpl.Entry {
+		fp := *v
+		set.Flows[fp.Name] = &fp
+	}
+	ofpl, err := olt.GetOnuFlowProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ofpl.Entry {
+		ofp := *v
+		set.OnuFlows[ofp.Name] = &ofp
+	}
+	vpl, err := olt.GetVlanProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range vpl.Entry {
+		vp := *v
+		set.Vlans[vp.Name] = &vp
+	}
+	return set, nil
+}
+
+// classification is the result of one frame against the Flow Profile of one service
+type classification struct {
+	Service string
+	Flow    string
+	Checks  []*matchCheck
+	Match   bool
+	Marking string
+	Policer string
+	// Onu is the result of the ONU Flow Profile upstream, empty downstream
+	Onu string
+}
+
+var ClassifyHeaders = []string{
+	"Service",
+	"Flow Profile",
+	"Result",
+	"Reason",
+	"Marking",
+	"Policer",
+	"ONU Flow",
+}
+
+var ClassifyCheckHeaders = []string{
+	"Criterion",
+	"Profile",
+	"Frame",
+	"Result",
+}
+
+// markedValue applies a PCP or DSCP marking type: none(1) keeps the value, copy(2) derives it from the other field, userValue(3) sets it
+func markedValue(markType, userValue, current, copied int) int {
+	switch markType {
+	case 2:
+		return copied
+	case 3:
+		return userValue
+	}
+	return current
+}
+
+func policerString(cdr, cdrBurst, pdr, pdrBurst int) string {
+	burst := func(b int) string {
+		if b == 0 {
+			return "default"
+		}
+		return fmt.Sprintf("%dkB", b)
+	}
+	return fmt.Sprintf("CDR %s/%s PDR %s/%s", formatKbps(cdr), burst(cdrBurst), formatKbps(pdr), burst(pdrBurst))
+}
+
+// classifyFrame evaluates the frame against the Flow Profile of the service in the direction given
+func classifyFrame(set *flowProfileSet, sp *gopon.ServiceProfile, f *frame, upstream bool) *classification {
+	c := &classification{Service: sp.Name, Flow: sp.FlowProfileName, Marking: "-", Policer: "-", Onu: "-"}
+	fp, ok := set.Flows[sp.FlowProfileName]
+	if !ok {
+		c.Flow = "-"
+		return c
+	}
+	scope := newFlowVlanScope(set.Vlans[sp.VlanProfileName])
+	if upstream {
+		c.Checks = flowMatchUs(fp).evaluate(f, scope)
+	} else {
+		c.Checks = flowMatchDs(fp).evaluate(f, scope)
+	}
+	c.Match = matched(c.Checks)
+	if !c.Match {
+		return c
+	}
+	// the copy markings derive the PCP from the class selector of the DSCP, and the DSCP from the PCP
+	csc := -1
+	if f.Dscp >= 0 {
+		csc = f.Dscp >> 3
+	}
+	fromPcp := -1
+	if f.CPcp >= 0 {
+		fromPcp = f.CPcp << 3
+	}
+	if upstream {
+		pcp := markedValue(fp.UsMarkPcp, fp.UsMarkPcpValue, f.CPcp, csc)
+		dscp := markedValue(fp.UsMarkDscp, fp.UsMarkDscpValue, f.Dscp, fromPcp)
+		c.Marking = fmt.Sprintf("PCP %s, DSCP %s", intString(pcp), intString(dscp))
+		c.Policer = policerString(fp.UsCdr, fp.UsCdrBurstSize, fp.UsPdr, fp.UsPdrBurstSize)
+		ofp, ok := set.OnuFlows[sp.OnuFlowProfileName]
+		if ok {
+			onu := onuFlowMatch(ofp).evaluate(f, nil)
+			if matched(onu) {
+				c.Onu = fmt.Sprintf("%s: CDR %s PDR %s prio %d", ofp.Name, formatKbps(ofp.UsCdr), formatKbps(ofp.UsPdr), ofp.UsFlowPriority)
+			} else {
+				c.Onu = fmt.Sprintf("%s: not carried, %s", ofp.Name, checkReason(onu))
+			}
+		}
+	} else {
+		pcp := markedValue(fp.DsMarkPcp, fp.DsMarkPcpValue, f.CPcp, csc)
+		dscp := markedValue(fp.DsMarkDscp, fp.DsMarkDscpValue, f.Dscp, fromPcp)
+		c.Marking = fmt.Sprintf("PCP %s, DSCP %s, queue %d %s", intString(pcp), intString(dscp), fp.DsQueuingPriority, fp.GetSchedulingMode())
+		c.Policer = policerString(fp.DsCdr, fp.DsCdrBurstSize, fp.DsPdr, fp.DsPdrBurstSize)
+	}
+	return c
+}
+
+// checkReason names the first failing criterion, or how many criteria matched
+func checkReason(checks []*matchCheck) string {
+	if len(checks) == 0 {
+		return "no criteria defined"
+	}
+	for _, c := range checks {
+		if !c.Pass {
+			return fmt.Sprintf("%s is %s, not %s", c.Criterion, c.Got, c.Want)
+		}
+	}
+	if len(checks) == 1 && checks[0].Criterion == "Any" {
+		return "matches any frame"
+	}
+	return fmt.Sprintf("%d criteria match", len(checks))
+}
+
+func resultString(match bool) string {
+	if match {
+		return "MATCH"
+	}
+	return "no match"
+}
+
+func tabwriteClassification(f *frame, dir string, list []*classification) {
+	var rows [][]string
+	var matches []string
+	for _, c := range list {
+		rows = append(rows, []string{c.Service, c.Flow, resultString(c.Match), checkReason(c.Checks), c.Marking, c.Policer, c.Onu})
+		if c.Match {
+			matches = append(matches, c.Service)
+		}
+	}
+	tabwriteTable(fmt.Sprintf("Frame %s %s: %s", f.Name, dir, f.summary()), ClassifyHeaders, rows)
+	if len(matches) > 1 {
+		fmt.Printf("!! Frame %s matches the Flow Profiles of %d services (%s), which one applies depends on the Service Profiles on the ONU\n", f.Name, len(matches), strings.Join(matches, ", "))
+	}
+}
+
+func tabwriteClassificationChecks(c *classification) {
+	var rows [][]string
+	for _, check := range c.Checks {
+		rows = append(rows, []string{check.Criterion, check.Want, check.Got, resultString(check.Pass)})
+	}
+	tabwriteTable(fmt.Sprintf("Criteria of Flow Profile %s", c.Flow), ClassifyCheckHeaders, rows)
+}
+
+// classifyCommand runs `classify`, evaluating frames against the Flow Profiles of one or all services
+func classifyCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("classify", flag.ContinueOnError)
+	service := fs.String("service", "", "Service Profile to classify against, all services when not given")
+	dir := fs.String("dir", "us", "Direction of the frame: us (from the ONU) or ds (towards the ONU)")
+	pcap := fs.String("pcap", "", "Classify the Ethernet frames of a pcap file instead of a frame description")
+	fs.Usage = func() {
+		fmt.Println("classify [-service name] [-dir us|ds] [-pcap file] [key=value...]")
+		fs.PrintDefaults()
+		fmt.Println("Frame description keys:")
+		for _, v := range FrameKeys {
+			fmt.Printf("  %s\n", v)
+		}
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	var upstream bool
+	switch strings.ToLower(*dir) {
+	case "us":
+		upstream = true
+	case "ds":
+	default:
+		return fmt.Errorf("unknown direction: %s", *dir)
+	}
+	var frames []*frame
+	if *pcap != "" {
+		frames, err = readPcapFrames(*pcap)
+		if err != nil {
+			if len(frames) == 0 {
+				return err
+			}
+			fmt.Printf("!! %v, classifying the %d frames read\n", err, len(frames))
+		}
+	} else {
+		if fs.NArg() == 0 {
+			fs.Usage()
+			return gopon.ErrNotInput
+		}
+		f, err := parseFrame("#1", fs.Args())
+		if err != nil {
+			return err
+		}
+		frames = append(frames, f)
+	}
+	set, err := getFlowProfileSet(olt)
+	if err != nil {
+		return err
+	}
+	var services []*gopon.ServiceProfile
+	for _, sp := range set.Services {
+		if *service == "" || sp.Name == *service {
+			services = append(services, sp)
+		}
+	}
+	if len(services) == 0 {
+		return gopon.ErrNotExists
+	}
+	for _, f := range frames {
+		var list []*classification
+		for _, sp := range services {
+			list = append(list, classifyFrame(set, sp, f, upstream))
+		}
+		tabwriteClassification(f, strings.ToLower(*dir), list)
+		if len(frames) == 1 && len(list) == 1 && len(list[0].Checks) > 0 {
+			tabwriteClassificationChecks(list[0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// commands run non-interactively after the OLT address, as `ponpro [options] <olt_ip> <command> [args...]`
+var CommandList = []string{
+	"audit security [-rules file] [-format text|junit|json]: check Security Profiles and the services using them against the compliance rules",
+	"classify [-service name] [-dir us|ds] [-pcap file] [key=value...]: show which Flow Profiles match a frame, with the marking and policer applied",
+	"overlap [-service name] [-dir us|ds|both]: find Flow Profiles that never match, or match the same frames as another on a shared VLAN",
+	"match [flow_profile] [\"us: ...; ds: ...\"]: show the match criteria of Flow Profiles as one line, or replace those of an unused profile",
+	"compare [-diff] <type> <a> <b>: show two profiles side by side, a service comparison includes every sub-profile",
+	"onu show <serial|slot/port/onu>: the Service Profiles of an ONU with the tagging, rates and security they apply",
+	"onu service [-dry-run] add|remove|swap <serial|slot/port/onu> <service...>: change the Service Profiles of an ONU after the T-CONT and GEM checks",
+	"onu import [-dry-run] [-batch n] [-results file] <rollout.csv>: provision ONUs from a CSV of serial, PON port, services and subscriber ID",
+	"show [-name glob|/regex/] [-inuse yes|no] [-where col<op>value] [-sort [-]col] [-columns a,b] <type|all>...: profile listings, the same options also apply to -sp and -mp",
+	"find [-type t1,t2] <query...>: profiles with a field matching vlan=100, rate>=100M, mac=00:11:22, ip=10.1 or <field>=<value>",
+}
+
+func printCommands() {
+	fmt.Println("Commands:")
+	for _, v := range CommandList {
+		fmt.Printf("  %s\n", v)
+	}
+}
+
+// runCommand dispatches the arguments following the OLT address
+func runCommand(olt *gopon.LumiaOlt, args []string) error {
+	switch strings.ToLower(args[0]) {
+	case "audit":
+		if len(args) < 2 {
+			return fmt.Errorf("audit requires a target, one of: security")
+		}
+		switch strings.ToLower(args[1]) {
+		case "security":
+			return auditSecurityCommand(olt, args[2:])
+		}
+		return fmt.Errorf("unknown audit target: %s", args[1])
+	case "classify":
+		return classifyCommand(olt, args[1:])
+	case "overlap":
+		return overlapCommand(olt, args[1:])
+	case "match":
+		return matchCommand(olt, args[1:])
+	case "compare":
+		return compareCommand(olt, args[1:])
+	case "show":
+		return showCommand(olt, args[1:])
+	case "find":
+		return findCommand(olt, args[1:])
+	case "onu":
+		return onuCommand(olt, args[1:])
+	}
+	printCommands()
+	return fmt.Errorf("unknown command: %s", args[0])
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// CompareTypes are the profile types `compare` takes, with the name the OLT gives them
+var CompareTypes = []string{
+	"service",
+	"flow",
+	"vlan",
+	"security",
+	"l2cp",
+	"multicast",
+	"onuflow",
+	"onuvlan",
+	"onumulticast",
+	"onutcont",
+}
+
+var compareTypeNames = map[string]string{
+	"service":      "Service",
+	"flow":         "Flow",
+	"vlan":         "VLAN",
+	"security":     "Security",
+	"l2cp":         "L2CP",
+	"multicast":    "Multicast",
+	"onuflow":      "ONU Flow",
+	"onuvlan":      "ONU VLAN",
+	"onumulticast": "ONU Multicast",
+	"onutcont":     "ONU T-CONT",
+}
+
+// serviceProfileRefs are the sub-profiles of a Service Profile by type, with the field naming them
+var serviceProfileRefs = [][2]string{
+	{"flow", "FlowProfileName"},
+	{"vlan", "VlanProfileName"},
+	{"security", "SecurityProfileName"},
+	{"l2cp", "L2cpProfileName"},
+	{"multicast", "MulticastProfileName"},
+	{"onuflow", "OnuFlowProfileName"},
+	{"onuvlan", "OnuVlanProfileName"},
+	{"onumulticast", "OnuMulticastProfileName"},
+	{"onutcont", "OnuTcontProfileName"},
+}
+
+// getProfileCopy fetches a profile by type and name, copied as the next request re-uses the memory it points into
+func getProfileCopy(olt *gopon.LumiaOlt, typ, name string) (interface{}, error) {
+	switch typ {
+	case "service":
+		p, err := olt.GetServiceProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *p, nil
+	case "flow":
+		p, err := olt.GetFlowProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *p, nil
+	case "vlan":
+		p, err := olt.GetVlanProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *p, nil
+	case "security":
+		p, err := olt.GetSecurityProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *p, nil
+	case "l2cp":
+		// gopon GetL2cpProfileByName only finds the last profile of the table
+		p, err := getL2cpProfileByName(olt, name)
+		if err != nil {
+			return nil, err
+		}
+		return p.L2cpProfile, nil
+	case "multicast":
+		p, err := olt.GetMulticastProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *p, nil
+	case "onuflow":
+		p, err := olt.GetOnuFlowProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *p, nil
+	case "onuvlan":
+		p, err := olt.GetOnuVlanProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *cloneOnuVlanProfile(p), nil
+	case "onumulticast":
+		p, err := olt.GetOnuMulticastProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *p, nil
+	case "onutcont":
+		p, err := olt.GetOnuTcontProfileByName(name)
+		if err != nil {
+			return nil, err
+		}
+		return *p, nil
+	}
+	return nil, fmt.Errorf("unknown profile type %s, one of: %s", typ, strings.Join(CompareTypes, ", "))
+}
+
+// compareValueString shows a field of a profile, with VLAN bitmaps resolved to their VLANs
+func compareValueString(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		if s == "" {
+			return "-"
+		}
+		if p, err := base64.StdEncoding.DecodeString(s); err == nil && len(p) == 512 {
+			list, _ := vlanListFromBitmap(s)
+			if len(list) == 0 {
+				return "none"
+			}
+			return "VLAN " + vlanRangeString(list)
+		}
+		return s
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return "-"
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// compareRows lists every field of two profiles of the same type, marking those that differ
+func compareRows(a, b interface{}, diffOnly bool) ([][]string, int) {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	var rows [][]string
+	var diffs int
+	for i := 0; i < va.NumField(); i++ {
+		f := va.Type().Field(i)
+		// the ONU VLAN rules are compared by rule below
+		if f.PkgPath != "" || f.Name == "Rules" {
+			continue
+		}
+		x, y := compareValueString(va.Field(i)), compareValueString(vb.Field(i))
+		mark := ""
+		if x != y {
+			mark = "*"
+			diffs++
+		} else if diffOnly {
+			continue
+		}
+		rows = append(rows, []string{mark, f.Name, x, y})
+	}
+	return rows, diffs
+}
+
+// compareOnuVlanRules pairs the rules of two ONU VLAN Profiles by rule ID
+func compareOnuVlanRules(a, b gopon.OnuVlanProfile, diffOnly bool) ([][]string, int) {
+	rules := func(p gopon.OnuVlanProfile) map[int]string {
+		m := make(map[int]string)
+		for _, r := range sortedOnuVlanRules(&p) {
+			m[r.RuleID] = fmt.Sprintf("%s => %s", r.GetMatchCriteriaString(), r.GetActionListString())
+		}
+		return m
+	}
+	ra, rb := rules(a), rules(b)
+	var ids []int
+	for id := range ra {
+		ids = append(ids, id)
+	}
+	for id := range rb {
+		if _, ok := ra[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	var rows [][]string
+	var diffs int
+	for _, id := range ids {
+		x, y := ra[id], rb[id]
+		if x == "" {
+			x = "-"
+		}
+		if y == "" {
+			y = "-"
+		}
+		mark := ""
+		if x != y {
+			mark = "*"
+			diffs++
+		} else if diffOnly {
+			continue
+		}
+		rows = append(rows, []string{mark, fmt.Sprintf("Rule %d", id), x, y})
+	}
+	return rows, diffs
+}
+
+// compareProfiles fetches and tabwrites two profiles of a type, returning how many fields differ
+func compareProfiles(olt *gopon.LumiaOlt, typ, a, b string, diffOnly bool) (int, error) {
+	pa, err := getProfileCopy(olt, typ, a)
+	if err != nil {
+		return 0, fmt.Errorf("%s Profile %s: %v", compareTypeNames[typ], a, err)
+	}
+	pb, err := getProfileCopy(olt, typ, b)
+	if err != nil {
+		return 0, fmt.Errorf("%s Profile %s: %v", compareTypeNames[typ], b, err)
+	}
+	return tabwriteComparison(typ, a, b, pa, pb, diffOnly), nil
+}
+
+// tabwriteComparison shows the fields of two fetched profiles side by side, returning how many differ
+func tabwriteComparison(typ, a, b string, pa, pb interface{}, diffOnly bool) int {
+	rows, diffs := compareRows(pa, pb, diffOnly)
+	if typ == "onuvlan" {
+		r, d := compareOnuVlanRules(pa.(gopon.OnuVlanProfile), pb.(gopon.OnuVlanProfile), diffOnly)
+		rows = append(rows, r...)
+		diffs += d
+	}
+	title := fmt.Sprintf("%s Profile %s / %s: %d differences", compareTypeNames[typ], a, b, diffs)
+	if len(rows) == 0 {
+		fmt.Printf("++ %s\n", title)
+		return diffs
+	}
+	tabwriteTable(title, []string{"", "Field", a, b}, rows)
+	return diffs
+}
+
+// compareServiceProfiles compares two Service Profiles and then each pair of sub-profiles they reference
+func compareServiceProfiles(olt *gopon.LumiaOlt, a, b string, diffOnly bool) error {
+	pa, err := getProfileCopy(olt, "service", a)
+	if err != nil {
+		return fmt.Errorf("Service Profile %s: %v", a, err)
+	}
+	pb, err := getProfileCopy(olt, "service", b)
+	if err != nil {
+		return fmt.Errorf("Service Profile %s: %v", b, err)
+	}
+	tabwriteComparison("service", a, b, pa, pb, diffOnly)
+	va, vb := reflect.ValueOf(pa), reflect.ValueOf(pb)
+	var total int
+	for _, ref := range serviceProfileRefs {
+		typ, field := ref[0], ref[1]
+		x, y := va.FieldByName(field).String(), vb.FieldByName(field).String()
+		switch {
+		case x == "" && y == "":
+			continue
+		case x == y:
+			fmt.Printf("++ Both use %s Profile %s\n", compareTypeNames[typ], x)
+			continue
+		case x == "" || y == "":
+			fmt.Printf("!! Only one service has a %s Profile: %s / %s\n", compareTypeNames[typ], compareValueString(va.FieldByName(field)), compareValueString(vb.FieldByName(field)))
+			total++
+			continue
+		}
+		n, err := compareProfiles(olt, typ, x, y, diffOnly)
+		if err != nil {
+			fmt.Printf("!! %v\n", err)
+			continue
+		}
+		total += n
+	}
+	fmt.Printf("++ %d differences in the sub-profiles of %s and %s\n", total, a, b)
+	return nil
+}
+
+// compareCommand runs `compare <type> <a> <b>`
+func compareCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	diffOnly := fs.Bool("diff", false, "Only show the fields that differ")
+	fs.Usage = func() {
+		fmt.Println("compare [-diff] <type> <a> <b>")
+		fs.PrintDefaults()
+		fmt.Printf("Types: %s\n", strings.Join(CompareTypes, ", "))
+		fmt.Println("Fields that differ are marked with *, a service comparison also compares every sub-profile")
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return gopon.ErrNotInput
+	}
+	typ := strings.ToLower(fs.Arg(0))
+	if _, ok := compareTypeNames[typ]; !ok {
+		return fmt.Errorf("unknown profile type %s, one of: %s", fs.Arg(0), strings.Join(CompareTypes, ", "))
+	}
+	if typ == "service" {
+		return compareServiceProfiles(olt, fs.Arg(1), fs.Arg(2), *diffOnly)
+	}
+	_, err = compareProfiles(olt, typ, fs.Arg(1), fs.Arg(2), *diffOnly)
+	return err
+}
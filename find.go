@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// FindKeys describes the queries `find` takes, any other key is compared to the profile field of that name
+var FindKeys = []string{
+	"vlan=100 or vlan=100-110: C-VID and S-VID fields, VLAN bitmaps and ONU VLAN rules",
+	"rate>=100M: CDR, PDR and T-CONT data rates in k, M or G (plain numbers are kbps), with = != < <= > >=",
+	"mac=00:11:22: MAC addresses starting with the given octets",
+	"ip=10.0.0.0: IPv4 and IPv6 addresses starting with the given value",
+	"<field>=<value>: any field by name, as TcontID=3 or MacLimit>=4",
+}
+
+// FindHeaders are the columns of the `find` results
+var FindHeaders = []string{
+	"Type",
+	"Name",
+	"Field",
+	"Value",
+	"In Use",
+	"Used By",
+}
+
+// findQuery is one term of a search, as key>=value
+type findQuery struct {
+	Key   string
+	Op    string
+	Value string
+	// Vlans is the value of a vlan query and Rate of a rate query in kbps
+	Vlans []int
+	Rate  int
+}
+
+// findOps are checked longest first so >= is not read as >
+var findOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+func parseFindQuery(term string) (*findQuery, error) {
+	for _, op := range findOps {
+		i := strings.Index(term, op)
+		if i < 1 {
+			continue
+		}
+		q := &findQuery{Key: strings.ToLower(term[:i]), Op: op, Value: strings.TrimSpace(term[i+len(op):])}
+		if q.Value == "" {
+			return nil, fmt.Errorf("%s has no value", term)
+		}
+		var err error
+		switch q.Key {
+		case "vlan":
+			if op != "=" {
+				return nil, fmt.Errorf("vlan only takes =")
+			}
+			q.Vlans, err = parseVlanList(q.Value)
+		case "rate":
+			q.Rate, err = parseRateKbps(q.Value)
+		case "mac":
+			if op != "=" {
+				return nil, fmt.Errorf("mac only takes =")
+			}
+			q.Value = macHex(q.Value)
+		case "ip":
+			if op != "=" {
+				return nil, fmt.Errorf("ip only takes =")
+			}
+			q.Value = strings.ToLower(q.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", term, err)
+		}
+		return q, nil
+	}
+	return nil, fmt.Errorf("%s is not key=value, see find -h", term)
+}
+
+// parseRateKbps reads a rate as 512k, 100M or 1G, a plain number is kbps
+func parseRateKbps(value string) (int, error) {
+	mult := 1.0
+	v := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(value), "bps"), "b")
+	switch {
+	case strings.HasSuffix(v, "g"):
+		mult = 1000000
+	case strings.HasSuffix(v, "m"):
+		mult = 1000
+	case strings.HasSuffix(v, "k"):
+	default:
+		v += "k"
+	}
+	n, err := strconv.ParseFloat(v[:len(v)-1], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("rate %s is not a number with k, M or G", value)
+	}
+	return int(n * mult), nil
+}
+
+// macHex leaves only the hex digits of a MAC address so 00:11:22, 00-11-22 and 0011.22 compare the same
+func macHex(mac string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("0123456789abcdef", r) {
+			return r
+		}
+		return -1
+	}, strings.ToLower(mac))
+}
+
+// compareFindInt applies the operator of a query to an int field
+func compareFindInt(v int, op string, want int) bool {
+	switch op {
+	case "=":
+		return v == want
+	case "!=":
+		return v != want
+	case ">":
+		return v > want
+	case ">=":
+		return v >= want
+	case "<":
+		return v < want
+	case "<=":
+		return v <= want
+	}
+	return false
+}
+
+// isVlanField is an int field holding a VLAN ID, the External fields are TruthValues
+func isVlanField(name string) bool {
+	n := strings.ToLower(name)
+	return (strings.HasSuffix(n, "vid") || strings.HasSuffix(n, "vlanid") || strings.Contains(n, "vidnative") ||
+		strings.Contains(n, "vidremark")) && !strings.HasSuffix(n, "external")
+}
+
+// isRateField is an int field holding a rate in kbps
+func isRateField(name string) bool {
+	return strings.HasSuffix(name, "DataRate") || strings.HasSuffix(name, "Cdr") || strings.HasSuffix(name, "Pdr")
+}
+
+func isMacField(name string) bool {
+	return strings.Contains(name, "Mac") && strings.HasSuffix(name, "Addr")
+}
+
+func isIPField(name string) bool {
+	return (strings.Contains(name, "IP") || strings.Contains(name, "Ip")) && (strings.HasSuffix(name, "Addr") || strings.HasSuffix(name, "Address"))
+}
+
+// matchField returns the value shown when a field matches the query, or false
+func (q *findQuery) matchField(name string, v reflect.Value) (string, bool) {
+	switch q.Key {
+	case "vlan":
+		switch v.Kind() {
+		case reflect.String:
+			if p, err := base64.StdEncoding.DecodeString(v.String()); err != nil || len(p) != 512 {
+				return "", false
+			}
+			list := flowVlans(v.String())
+			for _, x := range q.Vlans {
+				if containsInt(list, x) {
+					return "VLAN " + vlanRangeString(list), true
+				}
+			}
+		case reflect.Int:
+			n := int(v.Int())
+			if isVlanField(name) && n > 0 && n < 4095 && containsInt(q.Vlans, n) {
+				return strconv.Itoa(n), true
+			}
+		}
+	case "rate":
+		if v.Kind() == reflect.Int && isRateField(name) && v.Int() > 0 && compareFindInt(int(v.Int()), q.Op, q.Rate) {
+			return formatKbps(int(v.Int())), true
+		}
+	case "mac":
+		if v.Kind() == reflect.String && isMacField(name) && v.String() != "" && strings.HasPrefix(macHex(v.String()), q.Value) {
+			return v.String(), true
+		}
+	case "ip":
+		if v.Kind() == reflect.String && isIPField(name) && v.String() != "" && strings.HasPrefix(strings.ToLower(v.String()), q.Value) {
+			return v.String(), true
+		}
+	default:
+		if !strings.EqualFold(name, q.Key) {
+			return "", false
+		}
+		s := compareValueString(v)
+		if v.Kind() == reflect.Int {
+			want, err := strconv.Atoi(q.Value)
+			if err == nil {
+				return s, compareFindInt(int(v.Int()), q.Op, want)
+			}
+		}
+		switch q.Op {
+		case "=":
+			return s, strings.EqualFold(s, q.Value)
+		case "!=":
+			return s, !strings.EqualFold(s, q.Value)
+		}
+	}
+	return "", false
+}
+
+// findProfile is one profile to search with the type `compare` knows it by
+type findProfile struct {
+	Type    string
+	Name    string
+	Usage   int
+	Profile interface{}
+}
+
+// findProfiles lists every profile of every type, Service Profiles first
+func findProfiles(olt *gopon.LumiaOlt) ([]*findProfile, *profileTables, error) {
+	t, err := getProfileTables(olt)
+	if err != nil {
+		return nil, nil, err
+	}
+	var list []*findProfile
+	add := func(typ, name string, usage int, p interface{}) {
+		list = append(list, &findProfile{Type: typ, Name: name, Usage: usage, Profile: p})
+	}
+	for _, p := range t.Services {
+		add("service", p.Name, p.Usage, *p)
+	}
+	for _, p := range t.Flows {
+		add("flow", p.Name, p.Usage, *p)
+	}
+	for _, p := range t.Vlans {
+		add("vlan", p.Name, p.Usage, *p)
+	}
+	for _, p := range t.Securities {
+		add("security", p.Name, p.Usage, *p)
+	}
+	// gopon GetL2cpProfiles repeats the last profile of the table for every entry
+	l2cp, err := getL2cpProfiles(olt)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, v := range l2cp {
+		add("l2cp", v.Name, v.Usage, v.L2cpProfile)
+	}
+	for _, p := range t.Multicasts {
+		add("multicast", p.Name, p.Usage, *p)
+	}
+	for _, p := range t.OnuFlows {
+		add("onuflow", p.Name, p.Usage, *p)
+	}
+	for _, p := range t.OnuVlans {
+		add("onuvlan", p.Name, p.Usage, *p)
+	}
+	for _, p := range t.OnuMulticasts {
+		add("onumulticast", p.Name, p.Usage, *p)
+	}
+	for _, p := range t.Tconts {
+		add("onutcont", p.Name, p.Usage, *p)
+	}
+	order := make(map[string]int)
+	for i, typ := range CompareTypes {
+		order[typ] = i
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Type != list[j].Type {
+			return order[list[i].Type] < order[list[j].Type]
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, t, nil
+}
+
+// findFields returns the fields of a profile that match the query, as field and value, ONU VLAN rules by rule
+func findFields(p *findProfile, q *findQuery) [][2]string {
+	var out [][2]string
+	match := func(prefix string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" || f.Name == "Name" || f.Name == "Rules" {
+				continue
+			}
+			if s, ok := q.matchField(f.Name, v.Field(i)); ok {
+				out = append(out, [2]string{prefix + f.Name, s})
+			}
+		}
+	}
+	match("", reflect.ValueOf(p.Profile))
+	if ovp, ok := p.Profile.(gopon.OnuVlanProfile); ok {
+		for _, r := range sortedOnuVlanRules(&ovp) {
+			match(fmt.Sprintf("Rule %d ", r.RuleID), reflect.ValueOf(*r))
+		}
+	}
+	return out
+}
+
+func inUseString(usage int) string {
+	if usage == 1 {
+		return "yes"
+	}
+	return "no"
+}
+
+// usedByString names the Service Profiles referencing a sub-profile, or counts the ONUs of a Service Profile
+func usedByString(olt *gopon.LumiaOlt, t *profileTables, p *findProfile) string {
+	if p.Type == "service" {
+		if n := len(olt.GetOnuRegistryProfileUsage(p.Name)); n > 0 {
+			return fmt.Sprintf("%d ONUs", n)
+		}
+		return "-"
+	}
+	var names []string
+	for _, ref := range serviceProfileRefs {
+		if ref[0] != p.Type {
+			continue
+		}
+		for _, sp := range t.Services {
+			if reflect.ValueOf(*sp).FieldByName(ref[1]).String() == p.Name {
+				names = append(names, sp.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ", ")
+}
+
+// findCommand runs `find <query...>`, listing every field of every profile that matches all queries
+func findCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("find", flag.ContinueOnError)
+	types := fs.String("type", "", "Comma-separated profile types to search (default: all)")
+	fs.Usage = func() {
+		fmt.Println("find [-type t1,t2] <query...>")
+		fs.PrintDefaults()
+		fmt.Printf("Types: %s\n", strings.Join(CompareTypes, ", "))
+		fmt.Println("Queries, a profile is listed when it matches every query:")
+		printList(FindKeys)
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return gopon.ErrNotInput
+	}
+	var queries []*findQuery
+	for _, term := range fs.Args() {
+		q, err := parseFindQuery(term)
+		if err != nil {
+			return err
+		}
+		queries = append(queries, q)
+	}
+	only := make(map[string]bool)
+	for _, typ := range strings.Split(strings.ToLower(*types), ",") {
+		if typ == "" {
+			continue
+		}
+		if _, ok := compareTypeNames[typ]; !ok {
+			return fmt.Errorf("unknown profile type %s, one of: %s", typ, strings.Join(CompareTypes, ", "))
+		}
+		only[typ] = true
+	}
+	err = olt.UpdateOnuRegistry()
+	if err != nil {
+		return err
+	}
+	list, t, err := findProfiles(olt)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	var profiles int
+	for _, p := range list {
+		if len(only) > 0 && !only[p.Type] {
+			continue
+		}
+		var fields [][2]string
+		for _, q := range queries {
+			f := findFields(p, q)
+			if len(f) == 0 {
+				fields = nil
+				break
+			}
+			fields = append(fields, f...)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		profiles++
+		usedBy := usedByString(olt, t, p)
+		for _, f := range fields {
+			rows = append(rows, []string{compareTypeNames[p.Type], p.Name, f[0], f[1], inUseString(p.Usage), usedBy})
+		}
+	}
+	if len(rows) == 0 {
+		fmt.Printf("++ No profile matches %s\n", strings.Join(fs.Args(), " "))
+		return nil
+	}
+	tabwriteTable(fmt.Sprintf("%d profiles match %s", profiles, strings.Join(fs.Args(), " ")), FindHeaders, rows)
+	return nil
+}
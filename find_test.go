@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFindQuery(t *testing.T) {
+	tests := []struct {
+		term    string
+		want    findQuery
+		wantErr bool
+	}{
+		{term: "name=voice", want: findQuery{Key: "name", Op: "=", Value: "voice"}},
+		{term: "Rate>=100M", want: findQuery{Key: "rate", Op: ">=", Value: "100M", Rate: 100000}},
+		{term: "rate<=512k", want: findQuery{Key: "rate", Op: "<=", Value: "512k", Rate: 512}},
+		{term: "rate>1G", want: findQuery{Key: "rate", Op: ">", Value: "1G", Rate: 1000000}},
+		{term: "rate<64", want: findQuery{Key: "rate", Op: "<", Value: "64", Rate: 64}},
+		{term: "name!=hsi", want: findQuery{Key: "name", Op: "!=", Value: "hsi"}},
+		{term: "vlan=100-102,200", want: findQuery{Key: "vlan", Op: "=", Value: "100-102,200", Vlans: []int{100, 101, 102, 200}}},
+		{term: "mac=00:11:22:AA:BB:CC", want: findQuery{Key: "mac", Op: "=", Value: "001122aabbcc"}},
+		{term: "ip=2001:DB8::1", want: findQuery{Key: "ip", Op: "=", Value: "2001:db8::1"}},
+		{term: "name=a=b", want: findQuery{Key: "name", Op: "=", Value: "a=b"}},
+		{term: "name", wantErr: true},
+		{term: "=voice", wantErr: true},
+		{term: "name=", wantErr: true},
+		{term: "vlan>100", wantErr: true},
+		{term: "vlan=5000", wantErr: true},
+		{term: "mac!=001122334455", wantErr: true},
+		{term: "ip>10.0.0.1", wantErr: true},
+		{term: "rate=fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseFindQuery(tt.term)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, want error %v", tt.term, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.term, *got, tt.want)
+		}
+	}
+}
+
+func TestParseRateKbps(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"512", 512, false},
+		{"512k", 512, false},
+		{"512kbps", 512, false},
+		{"100M", 100000, false},
+		{"100Mb", 100000, false},
+		{"1.5m", 1500, false},
+		{"1G", 1000000, false},
+		{"2.5Gbps", 2500000, false},
+		{"0", 0, false},
+		{"k", 0, true},
+		{"-1M", 0, true},
+		{"fast", 0, true},
+		{"10T", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRateKbps(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
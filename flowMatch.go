@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// flowMatch is one direction of the match criteria of a Flow Profile,
+// an undefined criterion is -1 for values, empty for addresses and nil for VLAN lists
+type flowMatch struct {
+	Any              bool
+	VlanProfile      bool
+	MacDst           string
+	MacDstMask       string
+	MacSrc           string
+	MacSrcMask       string
+	CPcp             int
+	SPcp             int
+	CVlans           []int
+	SVlans           []int
+	Ethertype        int
+	IPProtocol       int
+	IPSrc            string
+	IPSrcMask        string
+	IPDst            string
+	IPDstMask        string
+	IPDscp           int
+	IPCsc            int
+	IPDropPrecedence int
+	TCPSrcPort       int
+	TCPDstPort       int
+	UDPSrcPort       int
+	UDPDstPort       int
+	IPv6Src          string
+	IPv6SrcLen       int
+	IPv6Dst          string
+	IPv6DstLen       int
+}
+
+// newFlowMatch has every criterion undefined
+func newFlowMatch() *flowMatch {
+	m := &flowMatch{}
+	for _, v := range m.values() {
+		*v = -1
+	}
+	return m
+}
+
+// values returns the criteria compared as a single value, -1 when undefined
+func (m *flowMatch) values() []*int {
+	return []*int{&m.CPcp, &m.SPcp, &m.Ethertype, &m.IPProtocol, &m.IPDscp, &m.IPCsc, &m.IPDropPrecedence, &m.TCPSrcPort, &m.TCPDstPort, &m.UDPSrcPort, &m.UDPDstPort}
+}
+
+// onuFlowMatch returns the upstream criteria of the ONU Flow Profile
+func onuFlowMatch(ofp *gopon.OnuFlowProfile) *flowMatch {
+	m := newFlowMatch()
+	m.CVlans = flowVlans(ofp.MatchUsCVlanIDRange)
+	m.CPcp = ofp.MatchUsCPcp
+	// without criteria the ONU Flow Profile carries every frame of the service
+	m.Any = len(m.CVlans) == 0 && m.CPcp < 0
+	return m
+}
+
+// vlanListFromBitmap resolves the base64 bitmap of VLAN membership 0-4095 to a list, nil when no VLAN is set
+func vlanListFromBitmap(b string) ([]int, error) {
+	if b == "" {
+		return nil, nil
+	}
+	p, err := base64.StdEncoding.DecodeString(b)
+	if err != nil {
+		return nil, err
+	}
+	var list []int
+	for i, x := range p {
+		for bit := 0; bit < 8; bit++ {
+			if x&(0x80>>uint(bit)) != 0 {
+				list = append(list, i*8+bit)
+			}
+		}
+	}
+	return list, nil
+}
+
+// vlanBitmapFromList is the base64 bitmap of VLAN membership the OLT expects, with no bit set for an empty list
+func vlanBitmapFromList(list []int) string {
+	p := make([]byte, 512)
+	for _, v := range list {
+		if v >= 0 && v < 4096 {
+			p[v/8] |= 0x80 >> uint(v%8)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(p)
+}
+
+// enabled returns the TruthValue of the OLT, 1 for true and 2 for false
+func enabled(b bool) int {
+	if b {
+		return 1
+	}
+	return 2
+}
+
+func flowVlans(b string) []int {
+	list, err := vlanListFromBitmap(b)
+	if err != nil {
+		fmt.Printf("!! Cannot decode VLAN list: %v\n", err)
+	}
+	return list
+}
+
+// flowMatchUs returns the upstream criteria of the Flow Profile
+func flowMatchUs(fp *gopon.FlowProfile) *flowMatch {
+	return &flowMatch{
+		Any:              fp.MatchUsAny == 1,
+		VlanProfile:      fp.MatchUsVlanProfile == 1,
+		MacDst:           fp.MatchUsMacDestAddr,
+		MacDstMask:       fp.MatchUsMacDestMask,
+		MacSrc:           fp.MatchUsMacSrcAddr,
+		MacSrcMask:       fp.MatchUsMacSrcMask,
+		CPcp:             fp.MatchUsCPcp,
+		SPcp:             fp.MatchUsSPcp,
+		CVlans:           flowVlans(fp.MatchUsCVlanIDRange),
+		SVlans:           flowVlans(fp.MatchUsSVlanIDRange),
+		Ethertype:        fp.MatchUsEthertype,
+		IPProtocol:       fp.MatchUsIPProtocol,
+		IPSrc:            fp.MatchUsIPSrcAddr,
+		IPSrcMask:        fp.MatchUsIPSrcMask,
+		IPDst:            fp.MatchUsIPDestAddr,
+		IPDstMask:        fp.MatchUsIPDestMask,
+		IPDscp:           fp.MatchUsIPDscp,
+		IPCsc:            fp.MatchUsIPCsc,
+		IPDropPrecedence: fp.MatchUsIPDropPrecedence,
+		TCPSrcPort:       fp.MatchUsTCPSrcPort,
+		TCPDstPort:       fp.MatchUsTCPDestPort,
+		UDPSrcPort:       fp.MatchUsUDPSrcPort,
+		UDPDstPort:       fp.MatchUsUDPDstPort,
+		IPv6Src:          fp.MatchUsIpv6SrcAddr,
+		IPv6SrcLen:       fp.MatchUsIpv6SrcAddrMaskLen,
+		IPv6Dst:          fp.MatchUsIpv6DstAddr,
+		IPv6DstLen:       fp.MatchUsIpv6DstAddrMaskLen,
+	}
+}
+
+// flowMatchDs returns the downstream criteria of the Flow Profile
+func flowMatchDs(fp *gopon.FlowProfile) *flowMatch {
+	return &flowMatch{
+		Any:              fp.MatchDsAny == 1,
+		VlanProfile:      fp.MatchDsVlanProfile == 1,
+		MacDst:           fp.MatchDsMacDestAddr,
+		MacDstMask:       fp.MatchDsMacDestMask,
+		MacSrc:           fp.MatchDsMacSrcAddr,
+		MacSrcMask:       fp.MatchDsMacSrcMask,
+		CPcp:             fp.MatchDsCPcp,
+		SPcp:             fp.MatchDsSPcp,
+		CVlans:           flowVlans(fp.MatchDsCVlanIDRange),
+		SVlans:           flowVlans(fp.MatchDsSVlanIDRange),
+		Ethertype:        fp.MatchDsEthertype,
+		IPProtocol:       fp.MatchDsIPProtocol,
+		IPSrc:            fp.MatchDsIPSrcAddr,
+		IPSrcMask:        fp.MatchDsIPSrcMask,
+		IPDst:            fp.MatchDsIPDestAddr,
+		IPDstMask:        fp.MatchDsIPDestMask,
+		IPDscp:           fp.MatchDsIPDscp,
+		IPCsc:            fp.MatchDsIPCsc,
+		IPDropPrecedence: fp.MatchDsIPDropPrecedence,
+		TCPSrcPort:       fp.MatchDsTCPSrcPort,
+		TCPDstPort:       fp.MatchDsTCPDestPort,
+		UDPSrcPort:       fp.MatchDsUDPSrcPort,
+		UDPDstPort:       fp.MatchDsUDPDstPort,
+		IPv6Src:          fp.MatchDsIpv6SrcAddr,
+		IPv6SrcLen:       fp.MatchDsIpv6SrcAddrMaskLen,
+		IPv6Dst:          fp.MatchDsIpv6DstAddr,
+		IPv6DstLen:       fp.MatchDsIpv6DstAddrMaskLen,
+	}
+}
+
+// setFlowMatchUs replaces every upstream criterion of the Flow Profile with those of the match
+func setFlowMatchUs(fp *gopon.FlowProfile, m *flowMatch) {
+	fp.MatchUsAny = enabled(m.Any)
+	fp.MatchUsVlanProfile = enabled(m.VlanProfile)
+	fp.MatchUsMacDestAddr = m.MacDst
+	fp.MatchUsMacDestMask = m.MacDstMask
+	fp.MatchUsMacSrcAddr = m.MacSrc
+	fp.MatchUsMacSrcMask = m.MacSrcMask
+	fp.MatchUsCPcp = m.CPcp
+	fp.MatchUsSPcp = m.SPcp
+	fp.MatchUsCVlanIDRange = vlanBitmapFromList(m.CVlans)
+	fp.MatchUsSVlanIDRange = vlanBitmapFromList(m.SVlans)
+	fp.MatchUsEthertype = m.Ethertype
+	fp.MatchUsIPProtocol = m.IPProtocol
+	fp.MatchUsIPSrcAddr = m.IPSrc
+	fp.MatchUsIPSrcMask = m.IPSrcMask
+	fp.MatchUsIPDestAddr = m.IPDst
+	fp.MatchUsIPDestMask = m.IPDstMask
+	fp.MatchUsIPDscp = m.IPDscp
+	fp.MatchUsIPCsc = m.IPCsc
+	fp.MatchUsIPDropPrecedence = m.IPDropPrecedence
+	fp.MatchUsTCPSrcPort = m.TCPSrcPort
+	fp.MatchUsTCPDestPort = m.TCPDstPort
+	fp.MatchUsUDPSrcPort = m.UDPSrcPort
+	fp.MatchUsUDPDstPort = m.UDPDstPort
+	fp.MatchUsIpv6SrcAddr = m.IPv6Src
+	fp.MatchUsIpv6SrcAddrMaskLen = m.IPv6SrcLen
+	fp.MatchUsIpv6DstAddr = m.IPv6Dst
+	fp.MatchUsIpv6DstAddrMaskLen = m.IPv6DstLen
+}
+
+// setFlowMatchDs replaces every downstream criterion of the Flow Profile with those of the match
+func setFlowMatchDs(fp *gopon.FlowProfile, m *flowMatch) {
+	fp.MatchDsAny = enabled(m.Any)
+	fp.MatchDsVlanProfile = enabled(m.VlanProfile)
+	fp.MatchDsMacDestAddr = m.MacDst
+	fp.MatchDsMacDestMask = m.MacDstMask
+	fp.MatchDsMacSrcAddr = m.MacSrc
+	fp.MatchDsMacSrcMask = m.MacSrcMask
+	fp.MatchDsCPcp = m.CPcp
+	fp.MatchDsSPcp = m.SPcp
+	fp.MatchDsCVlanIDRange = vlanBitmapFromList(m.CVlans)
+	fp.MatchDsSVlanIDRange = vlanBitmapFromList(m.SVlans)
+	fp.MatchDsEthertype = m.Ethertype
+	fp.MatchDsIPProtocol = m.IPProtocol
+	fp.MatchDsIPSrcAddr = m.IPSrc
+	fp.MatchDsIPSrcMask = m.IPSrcMask
+	fp.MatchDsIPDestAddr = m.IPDst
+	fp.MatchDsIPDestMask = m.IPDstMask
+	fp.MatchDsIPDscp = m.IPDscp
+	fp.MatchDsIPCsc = m.IPCsc
+	fp.MatchDsIPDropPrecedence = m.IPDropPrecedence
+	fp.MatchDsTCPSrcPort = m.TCPSrcPort
+	fp.MatchDsTCPDestPort = m.TCPDstPort
+	fp.MatchDsUDPSrcPort = m.UDPSrcPort
+	fp.MatchDsUDPDstPort = m.UDPDstPort
+	fp.MatchDsIpv6SrcAddr = m.IPv6Src
+	fp.MatchDsIpv6SrcAddrMaskLen = m.IPv6SrcLen
+	fp.MatchDsIpv6DstAddr = m.IPv6Dst
+	fp.MatchDsIpv6DstAddrMaskLen = m.IPv6DstLen
+}
+
+// flowVlanScope is the VLANs of the VLAN Profile a flow matches on when VlanProfile is set
+type flowVlanScope struct {
+	CVlans []int
+	SVlan  int
+}
+
+func newFlowVlanScope(vp *gopon.VlanProfile) *flowVlanScope {
+	if vp == nil {
+		return nil
+	}
+	return &flowVlanScope{CVlans: flowVlans(vp.CVid), SVlan: vp.SVid}
+}
+
+// matchCheck is the result of comparing a frame to one defined criterion
+type matchCheck struct {
+	Criterion string
+	Want      string
+	Got       string
+	Pass      bool
+}
+
+func intString(v int) string {
+	if v < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+func vlanListString(list []int) string {
+	if len(list) == 0 {
+		return "-"
+	}
+	var s []string
+	for _, v := range list {
+		s = append(s, fmt.Sprintf("%d", v))
+	}
+	return strings.Join(s, ",")
+}
+
+func containsInt(list []int, v int) bool {
+	for _, i := range list {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+// macMatches compares an address under an optional mask, an empty mask compares every bit
+func macMatches(addr, mask string, got net.HardwareAddr) (bool, error) {
+	want, err := net.ParseMAC(addr)
+	if err != nil {
+		return false, err
+	}
+	m := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if mask != "" {
+		m, err = net.ParseMAC(mask)
+		if err != nil {
+			return false, err
+		}
+	}
+	if got == nil || len(got) != len(want) || len(m) != len(want) {
+		return false, nil
+	}
+	for i := range want {
+		if want[i]&m[i] != got[i]&m[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ipMatches compares an IPv4 address under a dotted mask, or an IPv6 address under a prefix length
+func ipMatches(addr, mask string, prefixLen int, got net.IP) (bool, error) {
+	want := net.ParseIP(addr)
+	if want == nil {
+		return false, fmt.Errorf("invalid address %s", addr)
+	}
+	var m net.IPMask
+	if want.To4() != nil {
+		want = want.To4()
+		m = net.CIDRMask(32, 32)
+		if mask != "" {
+			mip := net.ParseIP(mask)
+			if mip == nil || mip.To4() == nil {
+				return false, fmt.Errorf("invalid mask %s", mask)
+			}
+			m = net.IPMask(mip.To4())
+		}
+	} else {
+		m = net.CIDRMask(128, 128)
+		if prefixLen > 0 && prefixLen <= 128 {
+			m = net.CIDRMask(prefixLen, 128)
+		}
+	}
+	if got == nil {
+		return false, nil
+	}
+	if len(want) == net.IPv4len {
+		got = got.To4()
+		if got == nil {
+			return false, nil
+		}
+	} else if got.To4() != nil {
+		return false, nil
+	}
+	return want.Mask(m).Equal(got.Mask(m)), nil
+}
+
+// evaluate compares the frame to every defined criterion, the frame matches when all of them pass
+func (m *flowMatch) evaluate(f *frame, scope *flowVlanScope) []*matchCheck {
+	var checks []*matchCheck
+	add := func(criterion, want, got string, pass bool) {
+		checks = append(checks, &matchCheck{Criterion: criterion, Want: want, Got: got, Pass: pass})
+	}
+	if m.Any {
+		add("Any", "any frame", "-", true)
+		return checks
+	}
+	if m.VlanProfile {
+		if scope == nil {
+			add("VlanProfile", "VLAN Profile of the service", "no VLAN Profile", false)
+		} else {
+			if len(scope.CVlans) > 0 {
+				add("VlanProfile C-VID", vlanListString(scope.CVlans), intString(f.CVlan), containsInt(scope.CVlans, f.CVlan))
+			}
+			// the S-tag is only present on frames on the network side
+			if scope.SVlan > 0 && f.SVlan >= 0 {
+				add("VlanProfile S-VID", intString(scope.SVlan), intString(f.SVlan), scope.SVlan == f.SVlan)
+			}
+		}
+	}
+	if m.MacDst != "" {
+		ok, err := macMatches(m.MacDst, m.MacDstMask, f.MacDst)
+		add("MacDest", maskedString(m.MacDst, m.MacDstMask), macString(f.MacDst), ok && err == nil)
+	}
+	if m.MacSrc != "" {
+		ok, err := macMatches(m.MacSrc, m.MacSrcMask, f.MacSrc)
+		add("MacSrc", maskedString(m.MacSrc, m.MacSrcMask), macString(f.MacSrc), ok && err == nil)
+	}
+	if m.CPcp >= 0 {
+		add("CPcp", intString(m.CPcp), intString(f.CPcp), m.CPcp == f.CPcp)
+	}
+	if m.SPcp >= 0 {
+		add("SPcp", intString(m.SPcp), intString(f.SPcp), m.SPcp == f.SPcp)
+	}
+	if len(m.CVlans) > 0 {
+		add("CVlanIDRange", vlanListString(m.CVlans), intString(f.CVlan), containsInt(m.CVlans, f.CVlan))
+	}
+	if len(m.SVlans) > 0 {
+		add("SVlanIDRange", vlanListString(m.SVlans), intString(f.SVlan), containsInt(m.SVlans, f.SVlan))
+	}
+	if m.Ethertype >= 0 {
+		add("Ethertype", fmt.Sprintf("0x%04x", m.Ethertype), ethertypeString(f.Ethertype), m.Ethertype == f.Ethertype)
+	}
+	if m.IPProtocol >= 0 {
+		add("IPProtocol", intString(m.IPProtocol), intString(f.Protocol), m.IPProtocol == f.Protocol)
+	}
+	if m.IPSrc != "" {
+		ok, err := ipMatches(m.IPSrc, m.IPSrcMask, 0, f.IPSrc)
+		add("IPSrc", maskedString(m.IPSrc, m.IPSrcMask), ipString(f.IPSrc), ok && err == nil)
+	}
+	if m.IPDst != "" {
+		ok, err := ipMatches(m.IPDst, m.IPDstMask, 0, f.IPDst)
+		add("IPDest", maskedString(m.IPDst, m.IPDstMask), ipString(f.IPDst), ok && err == nil)
+	}
+	if m.IPDscp >= 0 {
+		add("IPDscp", intString(m.IPDscp), intString(f.Dscp), m.IPDscp == f.Dscp)
+	}
+	if m.IPCsc >= 0 {
+		// the class selector is the three high bits of the DSCP
+		add("IPCsc", intString(m.IPCsc), intString(f.Dscp>>3), f.Dscp >= 0 && m.IPCsc == f.Dscp>>3)
+	}
+	if m.IPDropPrecedence >= 0 {
+		// the drop precedence of the assured forwarding classes is the two bits below the class
+		add("IPDropPrecedence", intString(m.IPDropPrecedence), intString((f.Dscp>>1)&3), f.Dscp >= 0 && m.IPDropPrecedence == (f.Dscp>>1)&3)
+	}
+	if m.TCPSrcPort >= 0 {
+		add("TcpSrcPort", intString(m.TCPSrcPort), l4PortString(f, ipProtocolTcp, f.SrcPort), f.Protocol == ipProtocolTcp && m.TCPSrcPort == f.SrcPort)
+	}
+	if m.TCPDstPort >= 0 {
+		add("TcpDestPort", intString(m.TCPDstPort), l4PortString(f, ipProtocolTcp, f.DstPort), f.Protocol == ipProtocolTcp && m.TCPDstPort == f.DstPort)
+	}
+	if m.UDPSrcPort >= 0 {
+		add("UdpSrcPort", intString(m.UDPSrcPort), l4PortString(f, ipProtocolUdp, f.SrcPort), f.Protocol == ipProtocolUdp && m.UDPSrcPort == f.SrcPort)
+	}
+	if m.UDPDstPort >= 0 {
+		add("UdpDstPort", intString(m.UDPDstPort), l4PortString(f, ipProtocolUdp, f.DstPort), f.Protocol == ipProtocolUdp && m.UDPDstPort == f.DstPort)
+	}
+	if m.IPv6Src != "" {
+		ok, err := ipMatches(m.IPv6Src, "", m.IPv6SrcLen, f.IPSrc)
+		add("Ipv6SrcAddr", prefixString(m.IPv6Src, m.IPv6SrcLen), ipString(f.IPSrc), ok && err == nil)
+	}
+	if m.IPv6Dst != "" {
+		ok, err := ipMatches(m.IPv6Dst, "", m.IPv6DstLen, f.IPDst)
+		add("Ipv6DstAddr", prefixString(m.IPv6Dst, m.IPv6DstLen), ipString(f.IPDst), ok && err == nil)
+	}
+	return checks
+}
+
+// matched is true when every check passed, a flow without criteria matches nothing
+func matched(checks []*matchCheck) bool {
+	if len(checks) == 0 {
+		return false
+	}
+	for _, c := range checks {
+		if !c.Pass {
+			return false
+		}
+	}
+	return true
+}
+
+func maskedString(addr, mask string) string {
+	if mask == "" {
+		return addr
+	}
+	return addr + "/" + mask
+}
+
+func prefixString(addr string, prefixLen int) string {
+	if prefixLen <= 0 {
+		return addr
+	}
+	return fmt.Sprintf("%s/%d", addr, prefixLen)
+}
@@ -15,7 +15,11 @@ func displayFlowProfiles(olt *gopon.LumiaOlt) error {
 	if err != nil {
 		return err
 	}
-	fpl.Tabwrite()
+	l := newProfileListing("flow", "Flow Profile List", gopon.FlowProfileHeaders)
+	for _, fp := range fpl.Entry {
+		l.addParams(fp.Name, fp.Usage, fp.ListEssentialParams())
+	}
+	tabwriteListing(l)
 	return nil
 }
 
@@ -56,10 +60,29 @@ func modifyFlowProfiles(olt *gopon.LumiaOlt, arg string) error {
 			return err
 		}
 	}
+	err = modifyMatchExpression(fp)
+	if err != nil {
+		return err
+	}
+	fmt.Print(">> Apply a QoS Class to this profile, or save it as one? (y/N)\n>> ")
+	input = strings.ToLower(sanitizeInput(readFromStdin()))
+	if input == "y" {
+		fp, err = qosClassHandler(fp)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(">> Modified %s Profile:\n", profType)
+		fp.Tabwrite()
+		fmt.Print(">> Make further modifications? (y/N)\n>> ")
+		input = strings.ToLower(sanitizeInput(readFromStdin()))
+		if input != "y" {
+			arg = "-"
+		}
+	}
 	if arg == "" {
 		arg = getArgFromSelection(gopon.FlowProfileHeaders)
 	}
-	for {
+	for arg != "-" {
 		modVal := getIntFromArg(arg, gopon.FlowProfileHeaders)
 		fp, err = modifyFlowProfileHandler(olt, fp, modVal)
 		if err != nil {
@@ -151,6 +174,9 @@ func modifyFlowProfileHandler(olt *gopon.LumiaOlt, fp *gopon.FlowProfile, modVal
 		if err != nil {
 			return nil, err
 		}
+		for _, w := range append(burstWarnings("UsCdrBurstSize", fp.UsCdr, fp.UsCdrBurstSize, defaultBurstRtt), burstWarnings("UsPdrBurstSize", fp.UsPdr, fp.UsPdrBurstSize, defaultBurstRtt)...) {
+			fmt.Printf("!! %s\n", w)
+		}
 	case 6:
 		// DsHandling
 		fmt.Printf(">> Current DsHandling parameters are: [%v]\n", fp.GetDsHandling())
@@ -160,6 +186,9 @@ func modifyFlowProfileHandler(olt *gopon.LumiaOlt, fp *gopon.FlowProfile, modVal
 		if err != nil {
 			return nil, err
 		}
+		for _, w := range append(burstWarnings("DsCdrBurstSize", fp.DsCdr, fp.DsCdrBurstSize, defaultBurstRtt), burstWarnings("DsPdrBurstSize", fp.DsPdr, fp.DsPdrBurstSize, defaultBurstRtt)...) {
+			fmt.Printf("!! %s\n", w)
+		}
 	case 7:
 		// QueuingPriority
 		fmt.Printf(">> Current Queuing Priority is [%s]. Provide new value: (0-7)\n>> ", fp.GetQueueingPriority())
@@ -833,6 +862,15 @@ func modifyUsHandling(olt *gopon.LumiaOlt, fp *gopon.FlowProfile, modVal int) (*
 	case 1:
 		//	"UsCdrBurstSize",
 		fmt.Println("++ Upstream committed data rate burst size in kB (0...16384). When parameter is set to 0 (default), it's automatically updated to default burst size in according with current QoSProfileInCdr value")
+		fmt.Print(">> Calculate a recommended burst size from the rate and RTT? (y/N)\n>> ")
+		if strings.ToLower(sanitizeInput(readFromStdin())) == "y" {
+			i, err := recommendBurstSize("UsCdrBurstSize", fp.UsCdr, fp.UsCdrBurstSize)
+			if err != nil {
+				return nil, err
+			}
+			fp.UsCdrBurstSize = i
+			return fp, nil
+		}
 		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", fp.UsCdrBurstSize)
 		newInt := sanitizeInput(readFromStdin())
 		if newInt != "" {
@@ -865,6 +903,15 @@ func modifyUsHandling(olt *gopon.LumiaOlt, fp *gopon.FlowProfile, modVal int) (*
 	case 3:
 		//	"UsPdrBurstSize",
 		fmt.Println("++ Upstream peak data rate burst size in kB (0...16384). When parameter is set to 0 (default), it's automatically updated to default burst size in according with current msanQoSProfileInPdr value")
+		fmt.Print(">> Calculate a recommended burst size from the rate and RTT? (y/N)\n>> ")
+		if strings.ToLower(sanitizeInput(readFromStdin())) == "y" {
+			i, err := recommendBurstSize("UsPdrBurstSize", fp.UsPdr, fp.UsPdrBurstSize)
+			if err != nil {
+				return nil, err
+			}
+			fp.UsPdrBurstSize = i
+			return fp, nil
+		}
 		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", fp.UsPdrBurstSize)
 		newInt := sanitizeInput(readFromStdin())
 		if newInt != "" {
@@ -970,6 +1017,15 @@ func modifyDsHandling(olt *gopon.LumiaOlt, fp *gopon.FlowProfile, modVal int) (*
 	case 1:
 		//	"DsCdrBurstSize",
 		fmt.Println("++ Downstream committed data rate burst size in kB (0...16384). When parameter is set to 0 (default), it's automatically updated to default burst size in according with current QoSProfileOutCdr value")
+		fmt.Print(">> Calculate a recommended burst size from the rate and RTT? (y/N)\n>> ")
+		if strings.ToLower(sanitizeInput(readFromStdin())) == "y" {
+			i, err := recommendBurstSize("DsCdrBurstSize", fp.DsCdr, fp.DsCdrBurstSize)
+			if err != nil {
+				return nil, err
+			}
+			fp.DsCdrBurstSize = i
+			return fp, nil
+		}
 		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", fp.DsCdrBurstSize)
 		newInt := sanitizeInput(readFromStdin())
 		if newInt != "" {
@@ -1002,6 +1058,15 @@ func modifyDsHandling(olt *gopon.LumiaOlt, fp *gopon.FlowProfile, modVal int) (*
 	case 3:
 		//	"DsPdrBurstSize",
 		fmt.Println("++ Downstream peak data rate burst size in kB (0...16384). When parameter is set to 0 (default), it's automatically updated to default burst size in according with current msanQoSProfileOutCdr value")
+		fmt.Print(">> Calculate a recommended burst size from the rate and RTT? (y/N)\n>> ")
+		if strings.ToLower(sanitizeInput(readFromStdin())) == "y" {
+			i, err := recommendBurstSize("DsPdrBurstSize", fp.DsPdr, fp.DsPdrBurstSize)
+			if err != nil {
+				return nil, err
+			}
+			fp.DsPdrBurstSize = i
+			return fp, nil
+		}
 		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", fp.DsPdrBurstSize)
 		newInt := sanitizeInput(readFromStdin())
 		if newInt != "" {
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	ethertypeIPv4  = 0x0800
+	ethertypeIPv6  = 0x86dd
+	ethertypeCTag  = 0x8100
+	ethertypeSTag  = 0x88a8
+	ethertypeQinQ  = 0x9100
+	ipProtocolTcp  = 6
+	ipProtocolUdp  = 17
+	pcapLinkTypeEn = 1
+)
+
+// frame is the description of a packet to classify, values not present are -1 or nil
+type frame struct {
+	Name      string
+	MacDst    net.HardwareAddr
+	MacSrc    net.HardwareAddr
+	CVlan     int
+	CPcp      int
+	SVlan     int
+	SPcp      int
+	Ethertype int
+	IPSrc     net.IP
+	IPDst     net.IP
+	Dscp      int
+	Protocol  int
+	SrcPort   int
+	DstPort   int
+}
+
+func newFrame(name string) *frame {
+	return &frame{
+		Name:      name,
+		CVlan:     -1,
+		CPcp:      -1,
+		SVlan:     -1,
+		SPcp:      -1,
+		Ethertype: -1,
+		Dscp:      -1,
+		Protocol:  -1,
+		SrcPort:   -1,
+		DstPort:   -1,
+	}
+}
+
+// FrameKeys lists the keys of a frame description, as `cvlan=100 cpcp=5 src=10.0.0.2 dscp=46 proto=udp dport=5060`
+var FrameKeys = []string{
+	"dmac: destination MAC address",
+	"smac: source MAC address",
+	"cvlan, cpcp: customer VLAN tag and priority",
+	"svlan, spcp: service VLAN tag and priority",
+	"ethertype: as 0x0800, set from the IP version when not given",
+	"src, dst: IPv4 or IPv6 address",
+	"dscp: 0...63",
+	"proto: tcp, udp, icmp, igmp or the protocol number",
+	"sport, dport: TCP or UDP port",
+}
+
+var ipProtocolNames = map[string]int{
+	"icmp":   1,
+	"igmp":   2,
+	"tcp":    ipProtocolTcp,
+	"udp":    ipProtocolUdp,
+	"icmpv6": 58,
+}
+
+func parseFrameInt(key, value string, min, max int) (int, error) {
+	// base 0 accepts 0x prefixed values such as an ethertype
+	i, err := strconv.ParseInt(value, 0, 32)
+	if err != nil || int(i) < min || int(i) > max {
+		return 0, fmt.Errorf("%s: %q is not a value in %d...%d", key, value, min, max)
+	}
+	return int(i), nil
+}
+
+// parseFrame reads a frame from key=value fields
+func parseFrame(name string, fields []string) (*frame, error) {
+	f := newFrame(name)
+	var err error
+	for _, field := range fields {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected key=value, got %q", field)
+		}
+		key, value := strings.ToLower(kv[0]), kv[1]
+		switch key {
+		case "dmac":
+			f.MacDst, err = net.ParseMAC(value)
+		case "smac":
+			f.MacSrc, err = net.ParseMAC(value)
+		case "cvlan":
+			f.CVlan, err = parseFrameInt(key, value, 0, 4095)
+		case "cpcp":
+			f.CPcp, err = parseFrameInt(key, value, 0, 7)
+		case "svlan":
+			f.SVlan, err = parseFrameInt(key, value, 0, 4095)
+		case "spcp":
+			f.SPcp, err = parseFrameInt(key, value, 0, 7)
+		case "ethertype":
+			f.Ethertype, err = parseFrameInt(key, value, 0, 65535)
+		case "src", "dst":
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("%s: %q is not an IP address", key, value)
+			}
+			if key == "src" {
+				f.IPSrc = ip
+			} else {
+				f.IPDst = ip
+			}
+		case "dscp":
+			f.Dscp, err = parseFrameInt(key, value, 0, 63)
+		case "proto":
+			if p, ok := ipProtocolNames[strings.ToLower(value)]; ok {
+				f.Protocol = p
+			} else {
+				f.Protocol, err = parseFrameInt(key, value, 0, 255)
+			}
+		case "sport":
+			f.SrcPort, err = parseFrameInt(key, value, 0, 65535)
+		case "dport":
+			f.DstPort, err = parseFrameInt(key, value, 0, 65535)
+		default:
+			return nil, fmt.Errorf("unknown key %q", kv[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if f.Ethertype < 0 {
+		for _, ip := range []net.IP{f.IPSrc, f.IPDst} {
+			if ip == nil {
+				continue
+			}
+			if ip.To4() != nil {
+				f.Ethertype = ethertypeIPv4
+			} else {
+				f.Ethertype = ethertypeIPv6
+			}
+		}
+	}
+	if f.Dscp < 0 && f.Ethertype >= 0 && (f.IPSrc != nil || f.IPDst != nil) {
+		f.Dscp = 0
+	}
+	return f, nil
+}
+
+// decodeEthernet reads the tags, IP header and ports of an Ethernet frame, stopping at the first header it cannot read
+func decodeEthernet(name string, b []byte) *frame {
+	f := newFrame(name)
+	if len(b) < 14 {
+		return f
+	}
+	f.MacDst = net.HardwareAddr(append([]byte(nil), b[0:6]...))
+	f.MacSrc = net.HardwareAddr(append([]byte(nil), b[6:12]...))
+	et := int(binary.BigEndian.Uint16(b[12:14]))
+	b = b[14:]
+	var tpids, tcis []int
+	for (et == ethertypeCTag || et == ethertypeSTag || et == ethertypeQinQ) && len(b) >= 4 {
+		tpids = append(tpids, et)
+		tcis = append(tcis, int(binary.BigEndian.Uint16(b[0:2])))
+		et = int(binary.BigEndian.Uint16(b[2:4]))
+		b = b[4:]
+	}
+	// the outer tag of a double tagged frame is the service tag, a single tag is the customer tag unless its TPID says otherwise
+	switch {
+	case len(tcis) >= 2:
+		f.SVlan, f.SPcp = tcis[0]&0x0fff, tcis[0]>>13
+		f.CVlan, f.CPcp = tcis[1]&0x0fff, tcis[1]>>13
+	case len(tcis) == 1 && tpids[0] == ethertypeCTag:
+		f.CVlan, f.CPcp = tcis[0]&0x0fff, tcis[0]>>13
+	case len(tcis) == 1:
+		f.SVlan, f.SPcp = tcis[0]&0x0fff, tcis[0]>>13
+	}
+	f.Ethertype = et
+	var l4 []byte
+	switch {
+	case et == ethertypeIPv4 && len(b) >= 20:
+		ihl := int(b[0]&0x0f) * 4
+		f.Dscp = int(b[1] >> 2)
+		f.Protocol = int(b[9])
+		f.IPSrc = net.IP(append([]byte(nil), b[12:16]...))
+		f.IPDst = net.IP(append([]byte(nil), b[16:20]...))
+		if ihl >= 20 && len(b) >= ihl {
+			l4 = b[ihl:]
+		}
+	case et == ethertypeIPv6 && len(b) >= 40:
+		f.Dscp = int((binary.BigEndian.Uint16(b[0:2]) >> 6) & 0x3f)
+		f.Protocol = int(b[6])
+		f.IPSrc = net.IP(append([]byte(nil), b[8:24]...))
+		f.IPDst = net.IP(append([]byte(nil), b[24:40]...))
+		l4 = b[40:]
+	}
+	if (f.Protocol == ipProtocolTcp || f.Protocol == ipProtocolUdp) && len(l4) >= 4 {
+		f.SrcPort = int(binary.BigEndian.Uint16(l4[0:2]))
+		f.DstPort = int(binary.BigEndian.Uint16(l4[2:4]))
+	}
+	return f
+}
+
+// readPcapFrames reads the Ethernet frames of a classic libpcap file, in microsecond or nanosecond format and either byte order
+func readPcapFrames(path string) ([]*frame, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	hdr := make([]byte, 24)
+	_, err = io.ReadFull(fd, hdr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a pcap file", path)
+	}
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(hdr[0:4]) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%s: not a pcap file, pcapng is not supported", path)
+	}
+	if order.Uint32(hdr[20:24]) != pcapLinkTypeEn {
+		return nil, fmt.Errorf("%s: link type %d is not Ethernet", path, order.Uint32(hdr[20:24]))
+	}
+	var list []*frame
+	rec := make([]byte, 16)
+	for n := 1; ; n++ {
+		_, err = io.ReadFull(fd, rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return list, fmt.Errorf("%s: truncated record %d", path, n)
+		}
+		capLen := order.Uint32(rec[8:12])
+		if capLen > 262144 {
+			return list, fmt.Errorf("%s: record %d is too large", path, n)
+		}
+		data := make([]byte, capLen)
+		_, err = io.ReadFull(fd, data)
+		if err != nil {
+			return list, fmt.Errorf("%s: truncated record %d", path, n)
+		}
+		list = append(list, decodeEthernet(fmt.Sprintf("#%d", n), data))
+	}
+	return list, nil
+}
+
+func macString(m net.HardwareAddr) string {
+	if m == nil {
+		return "-"
+	}
+	return m.String()
+}
+
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return "-"
+	}
+	return ip.String()
+}
+
+func ethertypeString(et int) string {
+	if et < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("0x%04x", et)
+}
+
+// l4PortString shows the port only when the frame carries the protocol it belongs to
+func l4PortString(f *frame, protocol, port int) string {
+	if f.Protocol != protocol {
+		return "not " + map[int]string{ipProtocolTcp: "TCP", ipProtocolUdp: "UDP"}[protocol]
+	}
+	return intString(port)
+}
+
+// summary describes the frame in one line
+func (f *frame) summary() string {
+	var s []string
+	if f.SVlan >= 0 {
+		s = append(s, fmt.Sprintf("S-VID %d/%d", f.SVlan, f.SPcp))
+	}
+	if f.CVlan >= 0 {
+		s = append(s, fmt.Sprintf("C-VID %d/%d", f.CVlan, f.CPcp))
+	}
+	if f.IPSrc != nil || f.IPDst != nil {
+		s = append(s, fmt.Sprintf("%s > %s", ipString(f.IPSrc), ipString(f.IPDst)))
+	} else if f.Ethertype >= 0 {
+		s = append(s, ethertypeString(f.Ethertype))
+	}
+	if f.Dscp >= 0 {
+		s = append(s, fmt.Sprintf("DSCP %d", f.Dscp))
+	}
+	if f.Protocol >= 0 {
+		p := fmt.Sprintf("proto %d", f.Protocol)
+		if f.SrcPort >= 0 || f.DstPort >= 0 {
+			p += fmt.Sprintf(" %s > %s", intString(f.SrcPort), intString(f.DstPort))
+		}
+		s = append(s, p)
+	}
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, ", ")
+}
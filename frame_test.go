@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  []string
+		want    frame
+		wantErr bool
+	}{
+		{
+			name:   "voice",
+			fields: []string{"cvlan=100", "cpcp=5", "src=10.0.0.2", "dscp=46", "proto=udp", "dport=5060"},
+			want: frame{CVlan: 100, CPcp: 5, SVlan: -1, SPcp: -1, Ethertype: ethertypeIPv4, IPSrc: net.ParseIP("10.0.0.2"),
+				Dscp: 46, Protocol: ipProtocolUdp, SrcPort: -1, DstPort: 5060},
+		},
+		{
+			name:   "ipv6 sets the ethertype and dscp 0",
+			fields: []string{"dst=2001:db8::1", "PROTO=tcp", "sport=80"},
+			want: frame{CVlan: -1, CPcp: -1, SVlan: -1, SPcp: -1, Ethertype: ethertypeIPv6, IPDst: net.ParseIP("2001:db8::1"),
+				Dscp: 0, Protocol: ipProtocolTcp, SrcPort: 80, DstPort: -1},
+		},
+		{
+			name:   "hex ethertype and protocol number",
+			fields: []string{"svlan=200", "spcp=3", "ethertype=0x8863", "proto=47"},
+			want: frame{CVlan: -1, CPcp: -1, SVlan: 200, SPcp: 3, Ethertype: 0x8863,
+				Dscp: -1, Protocol: 47, SrcPort: -1, DstPort: -1},
+		},
+		{name: "not key=value", fields: []string{"cvlan"}, wantErr: true},
+		{name: "unknown key", fields: []string{"vlan=1"}, wantErr: true},
+		{name: "vlan out of range", fields: []string{"cvlan=4096"}, wantErr: true},
+		{name: "pcp out of range", fields: []string{"cpcp=8"}, wantErr: true},
+		{name: "dscp out of range", fields: []string{"dscp=64"}, wantErr: true},
+		{name: "bad address", fields: []string{"src=10.0.0"}, wantErr: true},
+		{name: "bad mac", fields: []string{"dmac=00:11"}, wantErr: true},
+		{name: "unknown protocol name", fields: []string{"proto=sctp"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseFrame("f", tt.fields)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		tt.want.Name = "f"
+		if got.summary() != tt.want.summary() || !got.IPSrc.Equal(tt.want.IPSrc) || !got.IPDst.Equal(tt.want.IPDst) {
+			t.Errorf("%s: got %s, want %s", tt.name, got.summary(), tt.want.summary())
+		}
+		if got.CVlan != tt.want.CVlan || got.CPcp != tt.want.CPcp || got.SVlan != tt.want.SVlan || got.SPcp != tt.want.SPcp ||
+			got.Ethertype != tt.want.Ethertype || got.Dscp != tt.want.Dscp || got.Protocol != tt.want.Protocol ||
+			got.SrcPort != tt.want.SrcPort || got.DstPort != tt.want.DstPort {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+// testEthernet builds an Ethernet frame with the given tags, tpid and tci pairs, carrying an IPv4 UDP packet
+func testEthernet(tags []uint16, dscp int, sport, dport uint16) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x00, 0x66, 0x77, 0x88, 0x99, 0xaa})
+	for _, v := range tags {
+		binary.Write(&b, binary.BigEndian, v)
+	}
+	binary.Write(&b, binary.BigEndian, uint16(ethertypeIPv4))
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	ip[1] = byte(dscp << 2)
+	ip[9] = ipProtocolUdp
+	copy(ip[12:16], net.ParseIP("10.0.0.2").To4())
+	copy(ip[16:20], net.ParseIP("10.0.0.1").To4())
+	b.Write(ip)
+	binary.Write(&b, binary.BigEndian, sport)
+	binary.Write(&b, binary.BigEndian, dport)
+	b.Write(make([]byte, 4))
+	return b.Bytes()
+}
+
+func TestDecodeEthernet(t *testing.T) {
+	tests := []struct {
+		name                     string
+		data                     []byte
+		cvlan, cpcp, svlan, spcp int
+		ethertype, dscp          int
+		sport, dport             int
+	}{
+		{"untagged", testEthernet(nil, 46, 5060, 5061), -1, -1, -1, -1, ethertypeIPv4, 46, 5060, 5061},
+		{"customer tag", testEthernet([]uint16{ethertypeCTag, 5<<13 | 100}, 0, 1, 2), 100, 5, -1, -1, ethertypeIPv4, 0, 1, 2},
+		{"service tag", testEthernet([]uint16{ethertypeSTag, 3<<13 | 200}, 0, 1, 2), -1, -1, 200, 3, ethertypeIPv4, 0, 1, 2},
+		{"double tagged", testEthernet([]uint16{ethertypeQinQ, 1<<13 | 300, ethertypeCTag, 7<<13 | 10}, 10, 1, 2), 10, 7, 300, 1, ethertypeIPv4, 10, 1, 2},
+		{"runt", []byte{0x00, 0x11}, -1, -1, -1, -1, -1, -1, -1, -1},
+		{"truncated ip", testEthernet(nil, 46, 1, 2)[:20], -1, -1, -1, -1, ethertypeIPv4, -1, -1, -1},
+	}
+	for _, tt := range tests {
+		f := decodeEthernet(tt.name, tt.data)
+		if f.CVlan != tt.cvlan || f.CPcp != tt.cpcp || f.SVlan != tt.svlan || f.SPcp != tt.spcp {
+			t.Errorf("%s: tags %d/%d %d/%d, want %d/%d %d/%d", tt.name, f.CVlan, f.CPcp, f.SVlan, f.SPcp, tt.cvlan, tt.cpcp, tt.svlan, tt.spcp)
+		}
+		if f.Ethertype != tt.ethertype || f.Dscp != tt.dscp || f.SrcPort != tt.sport || f.DstPort != tt.dport {
+			t.Errorf("%s: got %s", tt.name, f.summary())
+		}
+	}
+}
+
+// testPcap writes a pcap file holding the frames in the given byte order
+func testPcap(t *testing.T, order binary.ByteOrder, linkType uint32, frames ...[]byte) string {
+	var b bytes.Buffer
+	binary.Write(&b, order, uint32(0xa1b2c3d4))
+	binary.Write(&b, order, []uint16{2, 4})
+	binary.Write(&b, order, []uint32{0, 0, 65535, linkType})
+	for _, f := range frames {
+		binary.Write(&b, order, []uint32{0, 0, uint32(len(f)), uint32(len(f))})
+		b.Write(f)
+	}
+	path := filepath.Join(t.TempDir(), "test.pcap")
+	err := ioutil.WriteFile(path, b.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadPcapFrames(t *testing.T) {
+	a := testEthernet([]uint16{ethertypeCTag, 100}, 46, 5060, 5060)
+	b := testEthernet(nil, 0, 53, 53)
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		list, err := readPcapFrames(testPcap(t, order, pcapLinkTypeEn, a, b))
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		if len(list) != 2 {
+			t.Fatalf("%v: %d frames, want 2", order, len(list))
+		}
+		if list[0].Name != "#1" || list[0].CVlan != 100 || list[0].DstPort != 5060 {
+			t.Errorf("%v: first frame %s", order, list[0].summary())
+		}
+		if list[1].Name != "#2" || list[1].CVlan != -1 || list[1].DstPort != 53 {
+			t.Errorf("%v: second frame %s", order, list[1].summary())
+		}
+	}
+}
+
+func TestReadPcapFramesErrors(t *testing.T) {
+	frame := testEthernet(nil, 0, 1, 2)
+	truncated := testPcap(t, binary.LittleEndian, pcapLinkTypeEn, frame)
+	data, err := ioutil.ReadFile(truncated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(truncated, data[:len(data)-3], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notPcap := filepath.Join(t.TempDir(), "notes.txt")
+	err = ioutil.WriteFile(notPcap, []byte("not a capture of anything at all"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		path   string
+		frames int
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.pcap"), 0},
+		{"not pcap", notPcap, 0},
+		{"not ethernet", testPcap(t, binary.LittleEndian, 113, frame), 0},
+		{"truncated record", truncated, 0},
+	}
+	for _, tt := range tests {
+		list, err := readPcapFrames(tt.path)
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+		if len(list) != tt.frames {
+			t.Errorf("%s: %d frames, want %d", tt.name, len(list), tt.frames)
+		}
+	}
+}
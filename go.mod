@@ -5,4 +5,5 @@ go 1.16
 require (
 	github.com/lindsaybb/gopon v0.0.0-20210316151451-020a4dadd1b2
 	github.com/secsy/goftp v0.0.0-20200609142545-aa2de14babf4 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
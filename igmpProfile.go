@@ -1,11 +1,49 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"strconv"
+	"strings"
 
 	"github.com/lindsaybb/gopon"
 )
 
+const (
+	igmpProfileTable = "msanMulticastProfileTable"
+	igmpProfileEntry = "msanMulticastProfileEntry"
+)
+
+// igmpProfile holds a gopon IgmpProfile read from the raw table, so edits do not point into the gopon tables,
+// with the querier settings gopon does not model when the OLT reports them
+type igmpProfile struct {
+	gopon.IgmpProfile
+	columns reportedColumns
+}
+
+// igmpQuerierColumns are looked up in the entries of the multicast profile table, RFC 3376 8.2 and 8.1
+var igmpQuerierColumns = []rawColumn{
+	{"Query Interval", []string{"QueryInterval"}},
+	{"Robustness", []string{"Robustness", "RobustnessVariable"}},
+}
+
+// IgmpProfileEditHeaders lists every editable element of the IGMP Profile
+var IgmpProfileEditHeaders = []string{
+	"Name",
+	"Snooping",
+	"Fast-Leave",
+	"Suppression",
+	"Proxy",
+	"Proxy Address",
+	"Filtering",
+	"Group Limit",
+	"MVR",
+	"Version",
+	"Query Interval",
+	"Robustness",
+}
+
 func displayIgmpProfiles(olt *gopon.LumiaOlt) error {
 	var err error
 	var ipl *gopon.IgmpProfileList
@@ -13,11 +51,304 @@ func displayIgmpProfiles(olt *gopon.LumiaOlt) error {
 	if err != nil {
 		return err
 	}
-	ipl.Tabwrite()
+	l := newProfileListing("multicast", "IGMP Profile List", gopon.IgmpProfileHeaders)
+	for _, ip := range ipl.Entry {
+		l.addParams(ip.Name, ip.Usage, ip.ListEssentialParams())
+	}
+	tabwriteListing(l)
 	return nil
 }
 
+// getIgmpProfileByName reads the profile from the raw table, the result does not point into the gopon tables
+func getIgmpProfileByName(olt *gopon.LumiaOlt, name string) (*igmpProfile, error) {
+	if name == "" {
+		return nil, gopon.ErrNotInput
+	}
+	entries, err := getRawTableEntries(olt, igmpProfileTable, igmpProfileEntry)
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range entries {
+		var ip igmpProfile
+		err = json.Unmarshal(raw, &ip)
+		if err != nil {
+			return nil, err
+		}
+		if ip.Name == name {
+			ip.columns, err = findReportedColumns(raw, ip.IgmpProfile, igmpQuerierColumns)
+			if err != nil {
+				return nil, err
+			}
+			return &ip, nil
+		}
+	}
+	return nil, gopon.ErrNotExists
+}
+
+// Copy returns a copy of the profile with a new name and Usage set to 2, leaving the original untouched
+func (p *igmpProfile) Copy(newName string) (*igmpProfile, error) {
+	if newName == "" {
+		return nil, gopon.ErrNotInput
+	}
+	if p.Name == newName {
+		return nil, gopon.ErrExists
+	}
+	np := *p
+	np.Name = newName
+	np.Usage = 2
+	np.columns = p.columns.copy()
+	return &np, nil
+}
+
+// GenerateJson serializes the profile for posting, with the querier settings the OLT reported
+func (p *igmpProfile) GenerateJson() (name string, data []byte) {
+	data, err := json.Marshal(p.IgmpProfile)
+	if err != nil {
+		return "", data
+	}
+	data, err = p.columns.merge(data)
+	if err != nil {
+		return "", data
+	}
+	return p.Name, data
+}
+
+func enabledString(v int) string {
+	if v == 1 {
+		return "Enabled"
+	}
+	return "Disabled"
+}
+
+func (p *igmpProfile) Tabwrite() {
+	proxyAddr := p.IgmpProxyIPAddress
+	if proxyAddr == "" {
+		proxyAddr = "OLT Mgmt"
+	}
+	row := []string{
+		p.Name,
+		enabledString(p.IgmpSnooping),
+		enabledString(p.IgmpSnoopingFastLeave),
+		enabledString(p.IgmpSnoopingSuppression),
+		enabledString(p.IgmpProxy),
+		proxyAddr,
+		enabledString(p.IgmpFiltering),
+		fmt.Sprintf("%d", p.MulticastGroupLimit),
+		enabledString(p.Mvr),
+		fmt.Sprintf("v%d", p.IgmpProxyProtocolVersion),
+		p.columns.cell("Query Interval", func(v int) string { return fmt.Sprintf("%ds", v) }),
+		p.columns.cell("Robustness", strconv.Itoa),
+	}
+	tabwriteTable("IGMP Profile", IgmpProfileEditHeaders, [][]string{row})
+}
+
 func modifyIgmpProfiles(olt *gopon.LumiaOlt) error {
-	fmt.Println("Modify the IGMP Profile Details placeholder")
+	profType := "IGMP"
+	err := displayIgmpProfiles(olt)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(">> Which %s Profile would you like to Modify?\n>> ", profType)
+	ipName := sanitizeInput(readFromStdin())
+	if ipName == "" {
+		return gopon.ErrNotInput
+	}
+	var ip *igmpProfile
+	ip, err = getIgmpProfileByName(olt, ipName)
+	if err != nil {
+		return err
+	}
+	ip.Tabwrite()
+	fmt.Print(">> Would you like to delete this profile? (y/N)\n>> ")
+	input := strings.ToLower(sanitizeInput(readFromStdin()))
+	if input == "y" {
+		if ip.Usage == 1 {
+			fmt.Println("!! Cannot delete in-use profile.")
+			return nil
+		} else {
+			return olt.DeleteMulticastProfile(ip.Name)
+		}
+	}
+	origName := ip.Name
+	if ip.Usage == 1 {
+		fmt.Println("!! Cannot modify in-use profile")
+		ip, err = modifyIgmpProfileHandler(olt, ip, 0)
+		if err != nil {
+			return err
+		}
+	}
+	arg := getArgFromSelection(IgmpProfileEditHeaders)
+	for {
+		modVal := getIntFromArg(arg, IgmpProfileEditHeaders)
+		ip, err = modifyIgmpProfileHandler(olt, ip, modVal)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(">> Modified %s Profile:\n", profType)
+		ip.Tabwrite()
+		fmt.Print(">> Make further modifications? (y/N)\n>> ")
+		modBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if modBool == "y" {
+			arg = getArgFromSelection(IgmpProfileEditHeaders)
+		} else {
+			break
+		}
+	}
+	err = validateIgmpProfile(ip)
+	if err != nil {
+		return err
+	}
+	fmt.Print(">> Post this modification? (Y/n)\n>> ")
+	postBool := strings.ToLower(sanitizeInput(readFromStdin()))
+	if postBool == "y" || postBool == "" {
+		if ip.Name == origName {
+			err = olt.DeleteMulticastProfile(ip.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return olt.PostMulticastProfile(ip.GenerateJson())
+	}
+	return nil
+}
+
+// validateIgmpProfile checks the combination of settings before posting, IGMPv1 has no Leave message (RFC 2236 9)
+func validateIgmpProfile(ip *igmpProfile) error {
+	if ip.IgmpSnoopingFastLeave == 1 && ip.IgmpProxyProtocolVersion == 1 {
+		fmt.Println("!! Fast-Leave relies on Leave messages, which IGMPv1 does not have")
+		return gopon.ErrNotInput
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// toggleIgmpValue flips a 1: enabled, 0: disabled value after confirmation
+func toggleIgmpValue(name string, v int) int {
+	fmt.Printf(">> %s is currently [%v], toggle status? (Y/n)\n>> ", name, enabledString(v))
+	togBool := strings.ToLower(sanitizeInput(readFromStdin()))
+	if togBool == "y" || togBool == "" {
+		if v == 1 {
+			return 0
+		}
+		return 1
+	}
+	return v
+}
+
+// getIgmpIntValue prompts for a value in the range min...max, an empty input keeps the current value
+func getIgmpIntValue(current, min, max int) (int, error) {
+	fmt.Printf(">> Current value is [%v], provide new value (%d...%d):\n>> ", current, min, max)
+	newInt := sanitizeInput(readFromStdin())
+	if newInt == "" {
+		return current, nil
+	}
+	i, err := strconv.Atoi(newInt)
+	if err != nil {
+		return current, gopon.ErrNotInput
+	}
+	if i < min || i > max {
+		fmt.Println("!! Value out of range, not set")
+		return current, nil
+	}
+	return i, nil
+}
+
+func modifyIgmpProfileHandler(olt *gopon.LumiaOlt, ip *igmpProfile, modVal int) (*igmpProfile, error) {
+	var err error
+	switch modVal {
+	case 0:
+		// Name
+		fmt.Print(">> Provide new name for IGMP Profile\n>> ")
+		newIpName := sanitizeInput(readFromStdin())
+		ip, err = ip.Copy(newIpName)
+		if err != nil {
+			return nil, err
+		}
+	case 1:
+		// Snooping
+		fmt.Println("++ IGMP Snooping forwards multicast only to the ports that have joined the group")
+		ip.IgmpSnooping = toggleIgmpValue("Snooping", ip.IgmpSnooping)
+	case 2:
+		// Fast-Leave
+		fmt.Println("++ Fast-Leave stops forwarding a group as soon as a Leave is received, without a group-specific query")
+		ip.IgmpSnoopingFastLeave = toggleIgmpValue("Fast-Leave", ip.IgmpSnoopingFastLeave)
+	case 3:
+		// Suppression
+		fmt.Println("++ Report Suppression forwards only one Report per group towards the multicast router")
+		ip.IgmpSnoopingSuppression = toggleIgmpValue("Suppression", ip.IgmpSnoopingSuppression)
+	case 4:
+		// Proxy
+		fmt.Println("++ IGMP Proxy answers queries on behalf of the subscribers and sends Reports from the Proxy Address")
+		ip.IgmpProxy = toggleIgmpValue("Proxy", ip.IgmpProxy)
+	case 5:
+		// Proxy Address
+		fmt.Println("++ Source address of the Proxy Reports, leave empty to use the OLT Management IP")
+		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", ip.IgmpProxyIPAddress)
+		addr := sanitizeInput(readFromStdin())
+		if addr == "" {
+			ip.IgmpProxyIPAddress = ""
+			break
+		}
+		parsed := net.ParseIP(addr)
+		if parsed == nil || parsed.To4() == nil {
+			fmt.Println("!! Not a valid IPv4 address")
+			return nil, gopon.ErrNotInput
+		}
+		if parsed.IsMulticast() || parsed.IsUnspecified() {
+			fmt.Println("!! Proxy Address must be a unicast address")
+			return nil, gopon.ErrNotInput
+		}
+		ip.IgmpProxyIPAddress = parsed.String()
+	case 6:
+		// Filtering
+		fmt.Println("++ IGMP Filtering drops Reports for groups that are not permitted on the port")
+		ip.IgmpFiltering = toggleIgmpValue("Filtering", ip.IgmpFiltering)
+	case 7:
+		// Group Limit
+		fmt.Println("++ Maximum number of simultaneous groups per port, 0 disables the limit")
+		ip.MulticastGroupLimit, err = getIgmpIntValue(ip.MulticastGroupLimit, 0, 1024)
+		if err != nil {
+			return nil, err
+		}
+	case 8:
+		// MVR
+		fmt.Println("++ Multicast VLAN Registration delivers groups from the multicast VLAN to subscribers in other VLANs")
+		ip.Mvr = toggleIgmpValue("MVR", ip.Mvr)
+	case 9:
+		// Version
+		fmt.Println("++ IGMP version used by the Proxy, IGMPv3 is required for source-specific multicast")
+		ip.IgmpProxyProtocolVersion, err = getIgmpIntValue(ip.IgmpProxyProtocolVersion, 1, 3)
+		if err != nil {
+			return nil, err
+		}
+	case 10:
+		// Query Interval
+		if !ip.columns.require("Query Interval", igmpProfileTable) {
+			break
+		}
+		fmt.Println("++ Seconds between General Queries, 125 by default (RFC 3376 8.2)")
+		v, _ := ip.columns.intValue("Query Interval")
+		v, err = getIgmpIntValue(v, 1, 31744)
+		if err != nil {
+			return nil, err
+		}
+		ip.columns.setInt("Query Interval", v)
+	case 11:
+		// Robustness
+		if !ip.columns.require("Robustness", igmpProfileTable) {
+			break
+		}
+		fmt.Println("++ Robustness Variable allows for expected packet loss, 2 by default (RFC 3376 8.1)")
+		v, _ := ip.columns.intValue("Robustness")
+		v, err = getIgmpIntValue(v, 1, 7)
+		if err != nil {
+			return nil, err
+		}
+		if v == 1 {
+			fmt.Println("!! A Robustness of 1 gives no tolerance for a lost Query or Report")
+		}
+		ip.columns.setInt("Robustness", v)
+	default:
+		fmt.Println("!! Unpexpected input, nothing to modify")
+	}
+	return ip, nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lindsaybb/gopon"
+	"gopkg.in/yaml.v2"
+)
+
+// InventoryHeaders are the columns of the OLT inventory listing
+var InventoryHeaders = []string{
+	"Name",
+	"Address",
+	"Model",
+	"Groups",
+	"Tags",
+	"Credentials",
+}
+
+// oltInventory is the file of named OLTs, by default ~/.config/ponpro/olts.yaml:
+//
+//	olts:
+//	  core-north:
+//	    address: 10.0.0.1
+//	    port: 443
+//	    scheme: https
+//	    credentials: env:PONPRO_CORE_NORTH  # or file:~/.config/ponpro/core-north.cred, holding user:password
+//	    connect_timeout: 2s
+//	    timeout: 30s
+//	    model: xgs-pon
+//	    tags: [north, residential]
+//	groups:
+//	  core: [core-north, core-south]
+//
+// The credentials and timeout apply to the tables ponPro reads and writes itself, the requests gopon makes
+// always log in as admin/admin and have no timeout, which gopon does not let ponPro change
+type oltInventory struct {
+	Olts   map[string]*oltEntry `yaml:"olts"`
+	Groups map[string][]string  `yaml:"groups"`
+}
+
+// oltEntry is one OLT of the inventory, gopon always speaks https with its own session so the credentials
+// and request timeout apply only to the requests ponPro makes itself
+type oltEntry struct {
+	Name           string   `yaml:"-"`
+	Address        string   `yaml:"address"`
+	Port           int      `yaml:"port"`
+	Scheme         string   `yaml:"scheme"`
+	Credentials    string   `yaml:"credentials"`
+	ConnectTimeout string   `yaml:"connect_timeout"`
+	Timeout        string   `yaml:"timeout"`
+	Model          string   `yaml:"model"`
+	Tags           []string `yaml:"tags"`
+	// set by check
+	groups         []string
+	connectTimeout time.Duration
+	timeout        time.Duration
+}
+
+// defaultInventoryPath is ~/.config/ponpro/olts.yaml, or under $XDG_CONFIG_HOME when set
+func defaultInventoryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ponpro", "olts.yaml")
+}
+
+// expandHome resolves a leading ~ to the home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+func loadInventory(path string) (*oltInventory, error) {
+	data, err := ioutil.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	inv := &oltInventory{}
+	err = yaml.UnmarshalStrict(data, inv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for name, o := range inv.Olts {
+		if o == nil {
+			return nil, fmt.Errorf("%s: OLT %s has no settings", path, name)
+		}
+		o.Name = name
+		err = o.check()
+		if err != nil {
+			return nil, fmt.Errorf("%s: OLT %s: %v", path, name, err)
+		}
+	}
+	for group, members := range inv.Groups {
+		if _, ok := inv.Olts[group]; ok {
+			return nil, fmt.Errorf("%s: group %s has the name of an OLT", path, group)
+		}
+		for _, m := range members {
+			o, ok := inv.Olts[m]
+			if !ok {
+				return nil, fmt.Errorf("%s: group %s lists %s, which is not an OLT", path, group, m)
+			}
+			o.groups = append(o.groups, group)
+		}
+	}
+	return inv, nil
+}
+
+// parseTimeout reads a duration as 2s or 500ms, a plain number is seconds
+func parseTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// check fills the defaults and rejects what gopon cannot connect with
+func (o *oltEntry) check() error {
+	if o.Address == "" {
+		return fmt.Errorf("no address")
+	}
+	if o.Port == 0 {
+		o.Port = 443
+	}
+	switch strings.ToLower(o.Scheme) {
+	case "", "https":
+		o.Scheme = "https"
+	default:
+		return fmt.Errorf("scheme %s is not supported, the OLT restconf API is https only", o.Scheme)
+	}
+	switch strings.ToLower(o.Model) {
+	case "", "gpon":
+		o.Model = "gpon"
+	case "xgs-pon", "xgspon", "xgs":
+		o.Model = "xgs-pon"
+	default:
+		return fmt.Errorf("model %s is not gpon or xgs-pon", o.Model)
+	}
+	var err error
+	o.connectTimeout, err = parseTimeout(o.ConnectTimeout)
+	if err != nil {
+		return fmt.Errorf("connect_timeout: %v", err)
+	}
+	if o.connectTimeout == 0 {
+		o.connectTimeout = time.Second
+	}
+	o.timeout, err = parseTimeout(o.Timeout)
+	if err != nil {
+		return fmt.Errorf("timeout: %v", err)
+	}
+	if o.Credentials != "" && !strings.HasPrefix(o.Credentials, "env:") && !strings.HasPrefix(o.Credentials, "file:") {
+		return fmt.Errorf("credentials %s is not env:<variable> or file:<path>", o.Credentials)
+	}
+	return nil
+}
+
+// host is what gopon puts in its urls, the port is only added when it is not the https default
+func (o *oltEntry) host() string {
+	if o.Port == 443 {
+		return o.Address
+	}
+	return net.JoinHostPort(o.Address, strconv.Itoa(o.Port))
+}
+
+// credentials resolves the reference to a user and password, admin/admin when the entry has none
+func (o *oltEntry) credentials() (string, string, error) {
+	var secret string
+	switch {
+	case o.Credentials == "":
+		return "admin", "admin", nil
+	case strings.HasPrefix(o.Credentials, "env:"):
+		name := strings.TrimPrefix(o.Credentials, "env:")
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", "", fmt.Errorf("credentials of %s: %s is not set", o.Name, name)
+		}
+		secret = v
+	case strings.HasPrefix(o.Credentials, "file:"):
+		data, err := ioutil.ReadFile(expandHome(strings.TrimPrefix(o.Credentials, "file:")))
+		if err != nil {
+			return "", "", fmt.Errorf("credentials of %s: %v", o.Name, err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	i := strings.Index(secret, ":")
+	if i < 1 {
+		return "", "", fmt.Errorf("credentials of %s are not user:password", o.Name)
+	}
+	return secret[:i], secret[i+1:], nil
+}
+
+// isReachable dials the restconf port within the connect timeout
+func (o *oltEntry) isReachable() bool {
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(o.Address, strconv.Itoa(o.Port)), o.connectTimeout)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// selectOlts resolves comma-separated OLT names, group names, tag:<tag> or all to the OLTs, in name order
+func (inv *oltInventory) selectOlts(selector string) ([]*oltEntry, error) {
+	picked := make(map[string]bool)
+	for _, s := range strings.Split(selector, ",") {
+		s = strings.TrimSpace(s)
+		switch {
+		case s == "":
+			continue
+		case s == "all":
+			for name := range inv.Olts {
+				picked[name] = true
+			}
+		case strings.HasPrefix(s, "tag:"):
+			tag := strings.TrimPrefix(s, "tag:")
+			found := false
+			for name, o := range inv.Olts {
+				for _, t := range o.Tags {
+					if t == tag {
+						picked[name] = true
+						found = true
+					}
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("no OLT is tagged %s", tag)
+			}
+		default:
+			if _, ok := inv.Olts[s]; ok {
+				picked[s] = true
+				continue
+			}
+			members, ok := inv.Groups[s]
+			if !ok {
+				return nil, fmt.Errorf("%s is not an OLT or group of the inventory", s)
+			}
+			for _, m := range members {
+				picked[m] = true
+			}
+		}
+	}
+	var list []*oltEntry
+	for name := range picked {
+		list = append(list, inv.Olts[name])
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	if len(list) == 0 {
+		return nil, gopon.ErrNotInput
+	}
+	return list, nil
+}
+
+// tabwriteInventory lists the OLTs of the inventory
+func tabwriteInventory(path string, inv *oltInventory) {
+	var names []string
+	for name := range inv.Olts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var rows [][]string
+	for _, name := range names {
+		o := inv.Olts[name]
+		rows = append(rows, []string{
+			o.Name,
+			fmt.Sprintf("%s://%s", o.Scheme, net.JoinHostPort(o.Address, strconv.Itoa(o.Port))),
+			o.Model,
+			nameOrDash(strings.Join(o.groups, ", ")),
+			nameOrDash(strings.Join(o.Tags, ", ")),
+			nameOrDash(o.Credentials),
+		})
+	}
+	tabwriteTable(fmt.Sprintf("OLT Inventory %s", path), InventoryHeaders, rows)
+}
+
+// activeOlt is the OLT the current command runs against, for the requests ponPro makes itself
+var activeOlt = &oltEntry{Port: 443, Scheme: "https", Model: "gpon", connectTimeout: time.Second}
+
+// useOlt makes an OLT the active one and connects to it, setting the PON technology from its model
+func useOlt(o *oltEntry) (*gopon.LumiaOlt, error) {
+	if _, _, err := o.credentials(); err != nil {
+		return nil, err
+	}
+	if !o.isReachable() {
+		return nil, fmt.Errorf("Host %s is not reachable", o.host())
+	}
+	activeOlt = o
+	if o.Model != "" {
+		*xgsPon = o.Model == "xgs-pon"
+	}
+	return gopon.NewLumiaOlt(o.host()), nil
+}
+
+// resolveTargets picks the OLTs from -o, or from the first argument as an inventory name or a bare host,
+// returning the arguments of the command that follow
+func resolveTargets(selector, path string, args []string) ([]*oltEntry, []string, error) {
+	var inv *oltInventory
+	var invErr error
+	if path != "" {
+		inv, invErr = loadInventory(path)
+	} else {
+		invErr = fmt.Errorf("no inventory file")
+	}
+	if selector != "" {
+		if invErr != nil {
+			return nil, nil, invErr
+		}
+		list, err := inv.selectOlts(selector)
+		return list, args, err
+	}
+	if len(args) == 0 {
+		return nil, nil, gopon.ErrNotInput
+	}
+	if inv != nil {
+		if list, err := inv.selectOlts(args[0]); err == nil {
+			return list, args[1:], nil
+		}
+	} else if !os.IsNotExist(invErr) && path != defaultInventoryPath() {
+		// an inventory given with -inventory has to load, a broken default one does not stop a bare host
+		return nil, nil, invErr
+	}
+	o := &oltEntry{Name: args[0], Address: args[0]}
+	if host, port, err := net.SplitHostPort(args[0]); err == nil {
+		o.Address = host
+		o.Port, _ = strconv.Atoi(port)
+	}
+	err := o.check()
+	if err != nil {
+		return nil, nil, err
+	}
+	// without an inventory entry the -xgs flag decides the technology
+	o.Model = ""
+	return []*oltEntry{o}, args[1:], nil
+}
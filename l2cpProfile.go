@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+const (
+	l2cpProfileTable = "msanL2cpProfileTable"
+	l2cpProfileEntry = "msanL2cpProfileEntry"
+)
+
+// the handling of the frames of a protocol, after the peer, pass and discard behaviours of MEF 45,
+// a value the OLT reports outside of these is shown as a number and not changed
+const (
+	l2cpPeer    = 1
+	l2cpTunnel  = 2
+	l2cpDiscard = 3
+)
+
+var L2cpActionList = []string{
+	"Peer",
+	"Tunnel",
+	"Discard",
+}
+
+// l2cpProfile holds a gopon L2cpProfile read from the raw table, which only models the Name and Description,
+// with the handling of each protocol the OLT reports for the entry
+type l2cpProfile struct {
+	gopon.L2cpProfile
+	columns reportedColumns
+}
+
+// l2cpProtocolColumns are looked up in the entries of the L2CP profile table, in the order of L2cpProfileHeaders
+var l2cpProtocolColumns = []rawColumn{
+	{"STP", []string{"Stp", "StpAction"}},
+	{"LACP", []string{"Lacp", "LacpAction"}},
+	{"LLDP", []string{"Lldp", "LldpAction"}},
+	{"Dot1X", []string{"Dot1x", "Dot1xAction", "Eapol"}},
+	{"OAM", []string{"Oam", "OamAction"}},
+	{"E-LMI", []string{"Elmi", "ElmiAction"}},
+	{"GVRP", []string{"Gvrp", "GvrpAction"}},
+	{"GMRP", []string{"Gmrp", "GmrpAction"}},
+}
+
+// L2cpProfileHeaders lists the elements of the L2CP Profile, the 802.1X column is named Dot1X so the
+// numeric selection is not shadowed
+var L2cpProfileHeaders = []string{
+	"Name",
+	"Description",
+	"STP",
+	"LACP",
+	"LLDP",
+	"Dot1X",
+	"OAM",
+	"E-LMI",
+	"GVRP",
+	"GMRP",
+}
+
+// newL2cpProfile creates a profile with the protocol columns of template, a profile the OLT reported,
+// as a new profile has no entry of its own to find them in
+func newL2cpProfile(name string, template *l2cpProfile) *l2cpProfile {
+	p := &l2cpProfile{L2cpProfile: *gopon.NewL2cpProfile(name), columns: reportedColumns{}}
+	if template != nil {
+		p.columns = template.columns.copy()
+	}
+	return p
+}
+
+func l2cpActionString(v int) string {
+	if v < l2cpPeer || v > l2cpDiscard {
+		return strconv.Itoa(v)
+	}
+	return L2cpActionList[v-1]
+}
+
+func (p *l2cpProfile) IsUsed() bool {
+	return p.Usage == 1
+}
+
+// Copy returns a copy of the profile with a new name and Usage set to 2, leaving the original untouched
+func (p *l2cpProfile) Copy(newName string) (*l2cpProfile, error) {
+	if newName == "" {
+		return nil, gopon.ErrNotInput
+	}
+	if p.Name == newName {
+		return nil, gopon.ErrExists
+	}
+	np := *p
+	np.Name = newName
+	np.Usage = 2
+	np.columns = p.columns.copy()
+	return &np, nil
+}
+
+// GenerateJson serializes the profile for posting, with the protocol handling the OLT reported
+func (p *l2cpProfile) GenerateJson() (name string, data []byte) {
+	data, err := json.Marshal(p.L2cpProfile)
+	if err != nil {
+		return "", data
+	}
+	data, err = p.columns.merge(data)
+	if err != nil {
+		return "", data
+	}
+	return p.Name, data
+}
+
+func (p *l2cpProfile) row() []string {
+	row := []string{p.Name, p.Description}
+	for _, c := range l2cpProtocolColumns {
+		row = append(row, p.columns.cell(c.Header, l2cpActionString))
+	}
+	return row
+}
+
+func (p *l2cpProfile) Tabwrite() {
+	tabwriteTable("L2CP Profile", L2cpProfileHeaders, [][]string{p.row()})
+}
+
+// getL2cpProfiles reads the profiles from the raw table, gopon GetL2cpProfiles returns
+// a list where every entry points to the last profile of the table
+func getL2cpProfiles(olt *gopon.LumiaOlt) ([]*l2cpProfile, error) {
+	entries, err := getRawTableEntries(olt, l2cpProfileTable, l2cpProfileEntry)
+	if err != nil {
+		return nil, err
+	}
+	var list []*l2cpProfile
+	for _, raw := range entries {
+		var p l2cpProfile
+		err = json.Unmarshal(raw, &p)
+		if err != nil {
+			return nil, err
+		}
+		p.columns, err = findReportedColumns(raw, p.L2cpProfile, l2cpProtocolColumns)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, &p)
+	}
+	return list, nil
+}
+
+func getL2cpProfileByName(olt *gopon.LumiaOlt, name string) (*l2cpProfile, error) {
+	if name == "" {
+		return nil, gopon.ErrNotInput
+	}
+	list, err := getL2cpProfiles(olt)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, gopon.ErrNotExists
+}
+
+// deleteL2cpProfile removes an unused profile, gopon DeleteL2cpProfile only finds the last profile of the table
+func deleteL2cpProfile(olt *gopon.LumiaOlt, name string) error {
+	lp, err := getL2cpProfileByName(olt, name)
+	if err != nil {
+		return err
+	}
+	if lp.IsUsed() {
+		return gopon.ErrInUse
+	}
+	resp, err := restTableRequest("DELETE", olt.Host, l2cpProfileTable, l2cpProfileEntry, name, nil)
+	if err != nil {
+		return err
+	}
+	if resp != responseOk {
+		fmt.Printf("!! %s\n", resp)
+		return gopon.ErrNotStatusOk
+	}
+	return nil
+}
+
+// postL2cpProfile posts the profile if the name is not already used, for the same reason as deleteL2cpProfile
+func postL2cpProfile(olt *gopon.LumiaOlt, lp *l2cpProfile) error {
+	_, err := getL2cpProfileByName(olt, lp.Name)
+	if err == nil {
+		return gopon.ErrExists
+	}
+	if err != gopon.ErrNotExists {
+		return err
+	}
+	name, data := lp.GenerateJson()
+	resp, err := restTableRequest("POST", olt.Host, l2cpProfileTable, l2cpProfileEntry, name, data)
+	if err != nil {
+		return err
+	}
+	if resp != responseOk {
+		fmt.Printf("!! %s\n", resp)
+		return gopon.ErrNotStatusOk
+	}
+	return nil
+}
+
+func displayL2cpProfiles(olt *gopon.LumiaOlt) error {
+	list, err := getL2cpProfiles(olt)
+	if err != nil {
+		return err
+	}
+	l := newProfileListing("l2cp", "L2CP Profile List", L2cpProfileHeaders)
+	for _, p := range list {
+		l.add(p.Name, p.Usage, p.row())
+	}
+	tabwriteListing(l)
+	return nil
+}
+
+func modifyL2cpProfiles(olt *gopon.LumiaOlt) error {
+	profType := "L2CP"
+	err := displayL2cpProfiles(olt)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(">> Which %s Profile would you like to Modify? A new name creates a profile\n>> ", profType)
+	lpName := sanitizeInput(readFromStdin())
+	if lpName == "" {
+		return gopon.ErrNotInput
+	}
+	// only a profile that exists on the OLT under this name needs to be removed before posting
+	existing := true
+	var lp *l2cpProfile
+	lp, err = getL2cpProfileByName(olt, lpName)
+	if err == gopon.ErrNotExists {
+		existing = false
+		fmt.Printf(">> Create new %s Profile %s? (Y/n)\n>> ", profType, lpName)
+		input := strings.ToLower(sanitizeInput(readFromStdin()))
+		if input != "y" && input != "" {
+			return nil
+		}
+		var list []*l2cpProfile
+		list, err = getL2cpProfiles(olt)
+		if err != nil {
+			return err
+		}
+		var template *l2cpProfile
+		if len(list) > 0 && len(list[0].columns) > 0 {
+			template = list[0]
+			fmt.Printf("++ The protocol handling starts as in %s Profile %s\n", profType, template.Name)
+		}
+		lp = newL2cpProfile(lpName, template)
+		lp.Tabwrite()
+	} else if err != nil {
+		return err
+	} else {
+		fmt.Print(">> Would you like to delete this profile? (y/N)\n>> ")
+		input := strings.ToLower(sanitizeInput(readFromStdin()))
+		if input == "y" {
+			if lp.IsUsed() {
+				fmt.Println("!! Cannot delete in-use profile.")
+				return nil
+			} else {
+				return deleteL2cpProfile(olt, lp.Name)
+			}
+		}
+	}
+	origName := lp.Name
+	if lp.IsUsed() {
+		fmt.Println("!! Cannot modify in-use profile")
+		lp, err = modifyL2cpProfileHandler(olt, lp, 0)
+		if err != nil {
+			return err
+		}
+	}
+	arg := getArgFromSelection(L2cpProfileHeaders)
+	for {
+		modVal := getIntFromArg(arg, L2cpProfileHeaders)
+		lp, err = modifyL2cpProfileHandler(olt, lp, modVal)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(">> Modified %s Profile:\n", profType)
+		lp.Tabwrite()
+		fmt.Print(">> Make further modifications? (y/N)\n>> ")
+		modBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if modBool == "y" {
+			arg = getArgFromSelection(L2cpProfileHeaders)
+		} else {
+			break
+		}
+	}
+	fmt.Print(">> Post this modification? (Y/n)\n>> ")
+	postBool := strings.ToLower(sanitizeInput(readFromStdin()))
+	if postBool == "y" || postBool == "" {
+		if existing && lp.Name == origName {
+			err = deleteL2cpProfile(olt, lp.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return postL2cpProfile(olt, lp)
+	}
+	return nil
+}
+
+func modifyL2cpProfileHandler(olt *gopon.LumiaOlt, lp *l2cpProfile, modVal int) (*l2cpProfile, error) {
+	var err error
+	switch modVal {
+	case 0:
+		// Name
+		fmt.Print(">> Provide new name for L2CP Profile\n>> ")
+		newLpName := sanitizeInput(readFromStdin())
+		lp, err = lp.Copy(newLpName)
+		if err != nil {
+			return nil, err
+		}
+	case 1:
+		// Description
+		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", lp.Description)
+		lp.Description = strings.TrimSpace(readFromStdin())
+	case 2, 3, 4, 5, 6, 7, 8, 9:
+		// protocol handling
+		header := L2cpProfileHeaders[modVal]
+		if !lp.columns.require(header, l2cpProfileTable) {
+			break
+		}
+		v, _ := lp.columns.intValue(header)
+		if v < l2cpPeer || v > l2cpDiscard {
+			fmt.Printf("!! The OLT reports %d for %s, which is not a handling ponPro knows, not changed\n", v, header)
+			break
+		}
+		fmt.Println("++ Peer: the OLT takes part in the protocol, Tunnel: frames pass to the network, Discard: frames are dropped")
+		fmt.Printf(">> Current value is [%v], provide new value (peer, tunnel, discard):\n>> ", l2cpActionString(v))
+		input := strings.ToLower(sanitizeInput(readFromStdin()))
+		if input == "" {
+			break
+		}
+		action := 0
+		for i, a := range L2cpActionList {
+			if input == strings.ToLower(a) || input == strconv.Itoa(i+1) {
+				action = i + 1
+			}
+		}
+		if action == 0 {
+			fmt.Println("!! Not peer, tunnel or discard, not set")
+			break
+		}
+		lp.columns.setInt(header, action)
+	default:
+		fmt.Println("!! Unpexpected input, nothing to modify")
+	}
+	return lp, nil
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// listOptions filter, sort and pick the columns of every profile listing, from the command line or `show`
+type listOptions struct {
+	Name    string
+	InUse   string
+	Where   stringList
+	Sort    string
+	Columns string
+	// Output is the format of every table, see OutputFormats
+	Output string
+}
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+var listOpts = &listOptions{Output: "text"}
+
+func init() {
+	listOpts.addFlags(flag.CommandLine)
+}
+
+// addFlags registers the listing options, defaulting to the values already set so `show` inherits the global ones
+func (o *listOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Name, "name", o.Name, "Only list profiles whose name matches a glob, or a regular expression as /expr/")
+	fs.StringVar(&o.InUse, "inuse", o.InUse, "Only list profiles that are in use (yes) or not (no)")
+	fs.Var(&o.Where, "where", "Only list profiles with a column matching, as \"Max Rate>=100M\" or Name~hsi; with = != ~ !~ < <= > >=, repeatable")
+	fs.StringVar(&o.Sort, "sort", o.Sort, "Sort by a column, prefixed with - to sort descending")
+	fs.StringVar(&o.Columns, "columns", o.Columns, "Comma-separated columns to show, in that order")
+	fs.StringVar(&o.Output, "output", o.Output, "Format of the tables: "+strings.Join(OutputFormats, ", "))
+}
+
+// listingEntry is one profile of a listing, on more than one line when it has rules
+type listingEntry struct {
+	Name  string
+	InUse bool
+	Lines [][]string
+}
+
+// profileListing is a table of profiles before the listing options are applied
+type profileListing struct {
+	// Type is the profile type as `show` and `compare` name it
+	Type    string
+	Title   string
+	Headers []string
+	Entries []*listingEntry
+	// Detail is the first column that is shown per line rather than per profile, DetailName groups those in the schema
+	Detail     int
+	DetailName string
+}
+
+func newProfileListing(typ, title string, headers []string) *profileListing {
+	return &profileListing{Type: typ, Title: title, Headers: headers, Detail: len(headers)}
+}
+
+func (l *profileListing) add(name string, usage int, lines ...[]string) {
+	l.Entries = append(l.Entries, &listingEntry{Name: name, InUse: usage == 1, Lines: lines})
+}
+
+// addParams adds a profile from the map its gopon ListEssentialParams returns, ordered by the headers
+func (l *profileListing) addParams(name string, usage int, params map[string]interface{}) {
+	row := make([]string, len(l.Headers))
+	for i, h := range l.Headers {
+		row[i] = fmt.Sprint(params[h])
+	}
+	l.add(name, usage, row)
+}
+
+// columnKey ignores case, spaces and punctuation so "max rate" finds "MaxRate" and "Max Rate"
+func columnKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '_' || r == '.' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+// column returns the index of a header by name, or a unique prefix of one
+func (l *profileListing) column(name string) int {
+	key := columnKey(name)
+	match := -1
+	for i, h := range l.Headers {
+		switch {
+		case columnKey(h) == key:
+			return i
+		case strings.HasPrefix(columnKey(h), key):
+			if match >= 0 {
+				return -1
+			}
+			match = i
+		}
+	}
+	return match
+}
+
+// listPredicate is one -where option resolved to a column of the listing
+type listPredicate struct {
+	Column int
+	Op     string
+	Value  string
+}
+
+// listOps are checked longest first at the position they are found
+var listOps = []string{">=", "<=", "!=", "!~", "=", "~", ">", "<"}
+
+func splitPredicate(expr string) (string, string, string, error) {
+	at, op := -1, ""
+	for _, o := range listOps {
+		i := strings.Index(expr, o)
+		if i > 0 && (at < 0 || i < at || (i == at && len(o) > len(op))) {
+			at, op = i, o
+		}
+	}
+	if at < 0 {
+		return "", "", "", fmt.Errorf("%s is not <column><op><value>", expr)
+	}
+	return strings.TrimSpace(expr[:at]), op, strings.TrimSpace(expr[at+len(op):]), nil
+}
+
+// listNumber reads a cell as a number, rates shown as 100.0M are compared in kbps
+func listNumber(s string) (float64, bool) {
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n, true
+	}
+	if s == "" || !strings.ContainsAny(s[len(s)-1:], "kKmMgG") {
+		return 0, false
+	}
+	if n, err := parseRateKbps(s); err == nil {
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// compareCells orders two cells numerically when both are numbers, otherwise as text ignoring case
+func compareCells(a, b string) int {
+	x, xok := listNumber(a)
+	y, yok := listNumber(b)
+	if xok && yok {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func (p *listPredicate) match(row []string) bool {
+	cell := row[p.Column]
+	switch p.Op {
+	case "~":
+		return strings.Contains(strings.ToLower(cell), strings.ToLower(p.Value))
+	case "!~":
+		return !strings.Contains(strings.ToLower(cell), strings.ToLower(p.Value))
+	}
+	c := compareCells(cell, p.Value)
+	switch p.Op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// nameMatcher reads -name as a glob, or as a regular expression between slashes
+func (o *listOptions) nameMatcher() (func(string) bool, error) {
+	if o.Name == "" {
+		return func(string) bool { return true }, nil
+	}
+	if len(o.Name) > 1 && strings.HasPrefix(o.Name, "/") && strings.HasSuffix(o.Name, "/") {
+		re, err := regexp.Compile(o.Name[1 : len(o.Name)-1])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	if _, err := filepath.Match(o.Name, ""); err != nil {
+		return nil, fmt.Errorf("-name %s: %v", o.Name, err)
+	}
+	return func(s string) bool {
+		ok, _ := filepath.Match(o.Name, s)
+		return ok
+	}, nil
+}
+
+// validate checks the options that do not depend on the listing
+func (o *listOptions) validate() error {
+	switch strings.ToLower(o.InUse) {
+	case "", "yes", "no":
+	default:
+		return fmt.Errorf("-inuse takes yes or no, not %s", o.InUse)
+	}
+	for _, w := range o.Where {
+		if _, _, _, err := splitPredicate(w); err != nil {
+			return err
+		}
+	}
+	_, err := o.nameMatcher()
+	return err
+}
+
+// apply filters and sorts the entries and picks the columns, a listing without a column an option names is noted
+// and, for -where, left out as none of its profiles can match
+func (o *listOptions) apply(l *profileListing) ([]int, []*listingEntry, bool) {
+	nameOk, err := o.nameMatcher()
+	if err != nil {
+		fmt.Printf("!! %v\n", err)
+		return nil, nil, false
+	}
+	var preds []*listPredicate
+	for _, w := range o.Where {
+		col, op, value, _ := splitPredicate(w)
+		i := l.column(col)
+		if i < 0 {
+			fmt.Printf("++ %s has no column %s\n", l.Title, col)
+			return nil, nil, false
+		}
+		preds = append(preds, &listPredicate{Column: i, Op: op, Value: value})
+	}
+	var entries []*listingEntry
+	for _, e := range l.Entries {
+		if !nameOk(e.Name) {
+			continue
+		}
+		if (o.InUse == "yes" && !e.InUse) || (o.InUse == "no" && e.InUse) {
+			continue
+		}
+		ok := true
+		for _, p := range preds {
+			// a profile on several lines matches when any of its lines does
+			lineOk := false
+			for _, line := range e.Lines {
+				if p.match(line) {
+					lineOk = true
+					break
+				}
+			}
+			if !lineOk {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			entries = append(entries, e)
+		}
+	}
+	if o.Sort != "" {
+		desc := strings.HasPrefix(o.Sort, "-")
+		i := l.column(strings.TrimPrefix(o.Sort, "-"))
+		if i < 0 {
+			fmt.Printf("++ %s has no column %s to sort by\n", l.Title, strings.TrimPrefix(o.Sort, "-"))
+		} else {
+			sort.SliceStable(entries, func(a, b int) bool {
+				c := compareCells(entries[a].Lines[0][i], entries[b].Lines[0][i])
+				if desc {
+					return c > 0
+				}
+				return c < 0
+			})
+		}
+	}
+	cols := make([]int, 0, len(l.Headers))
+	if o.Columns != "" {
+		for _, c := range strings.Split(o.Columns, ",") {
+			i := l.column(strings.TrimSpace(c))
+			if i < 0 {
+				fmt.Printf("++ %s has no column %s\n", l.Title, strings.TrimSpace(c))
+				continue
+			}
+			cols = append(cols, i)
+		}
+	}
+	if len(cols) == 0 {
+		for i := range l.Headers {
+			cols = append(cols, i)
+		}
+	}
+	return cols, entries, true
+}
+
+func pick(line []string, cols []int) []string {
+	row := make([]string, len(cols))
+	for j, i := range cols {
+		row[j] = line[i]
+	}
+	return row
+}
+
+// tabwriteListing shows a listing with the options applied, noting how many profiles were left out
+func tabwriteListing(l *profileListing) {
+	cols, entries, ok := listOpts.apply(l)
+	if !ok {
+		return
+	}
+	headers := pick(l.Headers, cols)
+	var rows [][]string
+	for _, e := range entries {
+		for _, line := range e.Lines {
+			rows = append(rows, pick(line, cols))
+		}
+	}
+	if listOpts.Output != "text" {
+		writeTable(l.outputTable(cols, entries, headers, rows))
+		return
+	}
+	title := l.Title
+	if len(entries) != len(l.Entries) {
+		title = fmt.Sprintf("%s (%d of %d)", l.Title, len(entries), len(l.Entries))
+	}
+	tabwriteTable(title, headers, rows)
+}
+
+// outputTable is the listing in the schema of its profile type, csv repeats the columns of a profile on each of its lines
+func (l *profileListing) outputTable(cols []int, entries []*listingEntry, headers []string, rows [][]string) *outputTable {
+	t := &outputTable{Type: l.Type, Title: l.Title, headers: headers}
+	var profileCols, detailCols []int
+	for _, i := range cols {
+		if i < l.Detail {
+			profileCols = append(profileCols, i)
+		} else {
+			detailCols = append(detailCols, i)
+		}
+	}
+	for _, e := range entries {
+		first := e.Lines[0]
+		obj := rowObject(pick(l.Headers, profileCols), pick(first, profileCols))
+		obj["in_use"] = e.InUse
+		if l.DetailName != "" {
+			details := []map[string]interface{}{}
+			for _, line := range e.Lines {
+				d := pick(line, detailCols)
+				if strings.Join(d, "") == "" {
+					continue
+				}
+				details = append(details, rowObject(pick(l.Headers, detailCols), d))
+			}
+			obj[l.DetailName] = details
+		}
+		t.Rows = append(t.Rows, obj)
+		for _, line := range e.Lines {
+			full := append([]string(nil), line...)
+			for i := 0; i < l.Detail && i < len(full); i++ {
+				full[i] = first[i]
+			}
+			t.lines = append(t.lines, pick(full, cols))
+		}
+	}
+	if t.Rows == nil {
+		t.Rows = []map[string]interface{}{}
+	}
+	return t
+}
+
+// showTypes maps the profile types of `show` to the entries of ProfileHandlerList
+var showTypes = map[string]int{
+	"service":      0,
+	"flow":         1,
+	"vlan":         2,
+	"onuflow":      3,
+	"onutcont":     4,
+	"onuvlan":      5,
+	"multicast":    6,
+	"onumulticast": 7,
+	"security":     8,
+	"l2cp":         9,
+}
+
+// showCommand runs `show [options] <type|all>...`, the profile listings with the listing options
+func showCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	listOpts.addFlags(fs)
+	fs.Usage = func() {
+		fmt.Println("show [options] <type|all>...")
+		fs.PrintDefaults()
+		fmt.Printf("Types: %s\n", strings.Join(CompareTypes, ", "))
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return gopon.ErrNotInput
+	}
+	err = listOpts.validate()
+	if err != nil {
+		return err
+	}
+	err = useOutputFormat(listOpts.Output)
+	if err != nil {
+		return err
+	}
+	var list []int
+	for _, typ := range fs.Args() {
+		typ = strings.ToLower(typ)
+		if typ == "all" {
+			list = append(list, -1)
+			continue
+		}
+		i, ok := showTypes[typ]
+		if !ok {
+			return fmt.Errorf("unknown profile type %s, one of: all, %s", typ, strings.Join(CompareTypes, ", "))
+		}
+		list = append(list, i)
+	}
+	for _, i := range list {
+		err = displayProfilesHandler(olt, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
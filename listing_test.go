@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestSplitPredicate(t *testing.T) {
+	tests := []struct {
+		expr              string
+		column, op, value string
+		wantErr           bool
+	}{
+		{expr: "Name=voice", column: "Name", op: "=", value: "voice"},
+		{expr: "Us CIR >= 100M", column: "Us CIR", op: ">=", value: "100M"},
+		{expr: "Usage<=2", column: "Usage", op: "<=", value: "2"},
+		{expr: "Name!=hsi", column: "Name", op: "!=", value: "hsi"},
+		{expr: "Name!~test", column: "Name", op: "!~", value: "test"},
+		{expr: "Name~vo", column: "Name", op: "~", value: "vo"},
+		{expr: "Rate>1G", column: "Rate", op: ">", value: "1G"},
+		{expr: "Rate<5", column: "Rate", op: "<", value: "5"},
+		{expr: "Name=a>b", column: "Name", op: "=", value: "a>b"},
+		{expr: "Name=", column: "Name", op: "=", value: ""},
+		{expr: "Name", wantErr: true},
+		{expr: "=voice", wantErr: true},
+	}
+	for _, tt := range tests {
+		column, op, value, err := splitPredicate(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, want error %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if column != tt.column || op != tt.op || value != tt.value {
+			t.Errorf("%q: got %q %q %q, want %q %q %q", tt.expr, column, op, value, tt.column, tt.op, tt.value)
+		}
+	}
+}
+
+func TestCompareCells(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"9", "10", -1},
+		{"10", "9", 1},
+		{"2.0", "2", 0},
+		{"100.0M", "100000", 0},
+		{"1G", "999M", 1},
+		{"512k", "1M", -1},
+		{"Voice", "voice", 0},
+		{"hsi", "iptv", -1},
+		{"form", "forma", -1},
+		{"9", "abc", -1},
+		{"-", "0", -1},
+	}
+	for _, tt := range tests {
+		if got := compareCells(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareCells(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strings"
 	"strconv"
+	"text/tabwriter"
 
 	"github.com/lindsaybb/gopon"
 )
@@ -16,25 +17,89 @@ var (
 	helpFlag      = flag.Bool("h", false, "Show this help")
 	showSpDetails = flag.Bool("sp", false, "View Detailed Information about Service Profiles")
 	modifyProfile = flag.Bool("mp", false, "Modify Service Profiles and the Profiles they contain, interactively")
+	showBudget    = flag.Bool("bw", false, "View the upstream T-CONT Bandwidth Budget of each PON Port")
+	xgsPon        = flag.Bool("xgs", false, "OLT is XGS-PON (9.95 Gbps upstream) instead of GPON (1.244 Gbps upstream)")
+	secPreset     = flag.Bool("preset", false, "Apply a Security Preset to a Security Profile, or save a Security Profile as a Preset")
+	oltFlag       = flag.String("o", "", "OLTs of the inventory: comma-separated names, groups, tag:<tag> or all")
+	inventoryPath = flag.String("inventory", defaultInventoryPath(), "OLT inventory file")
+	listOlts      = flag.Bool("olts", false, "List the OLTs of the inventory")
 )
 
 // purpose: modify service profiles on the fly based on a template from a file
 
-const usage = "`gopon sp demo` [options] <olt_ip>"
+const usage = "`gopon sp demo` [options] <olt_ip|olt_name|group> [command args...]\n       `gopon sp demo` [options] -o <olt_name|group|tag:tag|all> [command args...]"
 
 func main() {
 	flag.Parse()
 
-	if *helpFlag || flag.NArg() < 1 {
+	if *helpFlag || (flag.NArg() < 1 && *oltFlag == "" && !*listOlts) {
 		fmt.Println(usage)
 		flag.PrintDefaults()
+		printCommands()
 		return
 	}
 	var err error
-	host := flag.Args()[0]
-	olt := gopon.NewLumiaOlt(host)
-	if !olt.HostIsReachable() {
-		fmt.Printf("!! Host %s is not reachable\n", host)
+	err = listOpts.validate()
+	if err == nil {
+		err = useOutputFormat(listOpts.Output)
+	}
+	if err != nil {
+		fmt.Printf("!! %v\n", err)
+		return
+	}
+	defer flushOutput()
+	if *listOlts {
+		inv, err := loadInventory(*inventoryPath)
+		if err != nil {
+			fmt.Printf("!! %v\n", err)
+			return
+		}
+		tabwriteInventory(*inventoryPath, inv)
+		return
+	}
+	targets, args, err := resolveTargets(*oltFlag, *inventoryPath, flag.Args())
+	if err != nil {
+		fmt.Printf("!! %v\n", err)
+		return
+	}
+	fleetRun = len(targets) > 1
+	if len(args) > 0 {
+		failed := false
+		for _, o := range targets {
+			if fleetRun {
+				fmt.Printf("++ OLT %s (%s)\n", o.Name, o.host())
+			}
+			olt, err := useOlt(o)
+			if err == nil {
+				err = runCommand(olt, args)
+			}
+			if err != nil {
+				if fleetRun {
+					fmt.Printf("!! %s: %v\n", o.Name, err)
+				} else {
+					fmt.Printf("!! %v\n", err)
+				}
+				failed = true
+			}
+		}
+		flushOutput()
+		err = flushAuditReports()
+		if err != nil {
+			fmt.Printf("!! %v\n", err)
+			failed = true
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+	if fleetRun {
+		fmt.Printf("!! %d OLTs are selected, only a command runs on more than one\n", len(targets))
+		return
+	}
+	olt, err := useOlt(targets[0])
+	if err != nil {
+		fmt.Printf("!! %v\n", err)
 		return
 	}
 	if *showSpDetails {
@@ -57,6 +122,23 @@ func main() {
 			main()
 		}
 	}
+	if *showBudget {
+		fmt.Println(">> Show PON Bandwidth Budget called [-bw]")
+		err = displayPonBandwidthBudget(olt)
+		if err != nil {
+			fmt.Printf("!! Error running demo: %v\n", err)
+		}
+	}
+	if *secPreset {
+		fmt.Println(">> Security Presets called [-preset]")
+		err = securityPresetHandler(olt)
+		if err != nil {
+			fmt.Printf("!! Error running demo: %v\n", err)
+		}
+		if promptRerun() {
+			main()
+		}
+	}
 }
 
 var ProfileHandlerList = []string{
@@ -69,6 +151,7 @@ var ProfileHandlerList = []string{
 	"IGMP Profiles",
 	"ONU IGMP Profiles",
 	"Security Profiles",
+	"L2CP Profiles",
 }
 
 // use this to decide which displays are called by adding a flag to the function call
@@ -136,6 +219,12 @@ func displayProfilesHandler(olt *gopon.LumiaOlt, modVal int) error {
 		if err != nil {
 			return err
 		}
+	case 9:
+		// L2CP Profiles
+		err = displayL2cpProfiles(olt)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -169,8 +258,7 @@ func modifyProfileHandler(olt *gopon.LumiaOlt) error {
 	case 10:
 		return modifyOnuIgmpProfiles(olt)
 	case 11:
-		fmt.Println("!! L2CP not implemented currently")
-		return nil
+		return modifyL2cpProfiles(olt)
 	case 12:
 		return modifyServiceProfiles(olt, "dhcp")
 	case 13:
@@ -186,6 +274,39 @@ func printList(list []string) {
 	}
 }
 
+// tabwriteTable prints rows in organized columns using the same layout as the gopon Tabwrite methods
+func tabwriteTable(title string, headers []string, rows [][]string) {
+	if listOpts.Output != "text" {
+		t := &outputTable{Title: title, Rows: []map[string]interface{}{}, headers: headers, lines: rows}
+		for _, row := range rows {
+			t.Rows = append(t.Rows, rowObject(headers, row))
+		}
+		writeTable(t)
+		return
+	}
+	fmt.Printf("|| %s ||\n", title)
+	tw := new(tabwriter.Writer).Init(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, v := range headers {
+		fmt.Fprintf(tw, "%v\t", v)
+	}
+	fmt.Fprintf(tw, "\n")
+	for _, v := range headers {
+		fmt.Fprintf(tw, "%v\t", strings.Repeat("-", len(v)))
+	}
+	fmt.Fprintf(tw, "\n")
+	for _, row := range rows {
+		for _, v := range row {
+			fmt.Fprintf(tw, "%v\t", v)
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	for _, v := range headers {
+		fmt.Fprintf(tw, "%v\t", strings.Repeat("-", len(v)))
+	}
+	fmt.Fprintf(tw, "\n")
+	tw.Flush()
+}
+
 func stringListToIntList(str []string) (l []int, err error) {
 	for _, v := range str {
 		i, err := strconv.Atoi(v)
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// MatchExprKeys lists the terms of a match expression, as `us: cvlan=100-110 pcp=5 ipproto=udp dport=5060 dscp=ef; ds: any`
+var MatchExprKeys = []string{
+	"any: match every frame",
+	"vlanprofile: match the VLANs of the VLAN Profile of the service",
+	"none: no criteria",
+	"dmac, smac: MAC address with an optional /mask",
+	"cvlan, svlan: VLAN list as 100-110,200",
+	"pcp, spcp: C-tag and S-tag priority 0...7",
+	"ethertype: ipv4, ipv6, arp, pppoe-disc, pppoe or the value as 0x8100",
+	"ipproto: tcp, udp, icmp, igmp, icmpv6 or the protocol number",
+	"src, dst: IPv4 address with /mask or /len, IPv6 address with /len",
+	"dscp: ef, af11...af43, cs0...cs7, be or 0...63",
+	"csc: class selector 0...7, dp: drop precedence 0...3",
+	"sport, dport: a single port of the ipproto given, tcp-sport, tcp-dport, udp-sport and udp-dport otherwise",
+}
+
+var ethertypeNames = map[string]int{
+	"ipv4":       ethertypeIPv4,
+	"ipv6":       ethertypeIPv6,
+	"arp":        0x0806,
+	"pppoe-disc": 0x8863,
+	"pppoe":      0x8864,
+}
+
+// nameOf returns the key of the value in a name map, or the value formatted
+func nameOf(names map[string]int, v int, format string) string {
+	var keys []string
+	for k, i := range names {
+		if i == v {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Sprintf(format, v)
+	}
+	// icmp and icmpv6 never share a value, sorting only keeps the result stable
+	sort.Strings(keys)
+	return keys[0]
+}
+
+// parseDscp reads a per hop behaviour name or a DSCP value
+func parseDscp(value string) (int, error) {
+	v := strings.ToLower(value)
+	switch {
+	case v == "ef":
+		return 46, nil
+	case v == "be" || v == "df":
+		return 0, nil
+	case len(v) == 4 && strings.HasPrefix(v, "af") && v[2] >= '1' && v[2] <= '4' && v[3] >= '1' && v[3] <= '3':
+		return int(v[2]-'0')*8 + int(v[3]-'0')*2, nil
+	case len(v) == 3 && strings.HasPrefix(v, "cs") && v[2] >= '0' && v[2] <= '7':
+		return int(v[2]-'0') * 8, nil
+	}
+	return parseFrameInt("dscp", value, 0, 63)
+}
+
+func dscpString(v int) string {
+	switch {
+	case v == 46:
+		return "ef"
+	case v > 0 && v%8 == 0:
+		return fmt.Sprintf("cs%d", v/8)
+	case v>>3 >= 1 && v>>3 <= 4 && v&1 == 0 && (v>>1)&3 >= 1:
+		return fmt.Sprintf("af%d%d", v>>3, (v>>1)&3)
+	}
+	return strconv.Itoa(v)
+}
+
+// parseVlanList reads VLANs and ranges separated by commas
+func parseVlanList(value string) ([]int, error) {
+	var list []int
+	for _, r := range strings.Split(value, ",") {
+		lo, hi, err := parseRange(r, 0, 4095)
+		if err != nil {
+			return nil, err
+		}
+		for v := lo; v <= hi; v++ {
+			if !containsInt(list, v) {
+				list = append(list, v)
+			}
+		}
+	}
+	sort.Ints(list)
+	return list, nil
+}
+
+// parseRange reads a value or a range as 100-110 within min...max
+func parseRange(value string, min, max int) (int, int, error) {
+	bounds := strings.SplitN(value, "-", 2)
+	lo, err := parseFrameInt("range", bounds[0], min, max)
+	if err != nil {
+		return 0, 0, err
+	}
+	hi := lo
+	if len(bounds) == 2 {
+		hi, err = parseFrameInt("range", bounds[1], min, max)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if hi < lo {
+		return 0, 0, fmt.Errorf("range %s ends before it starts", value)
+	}
+	return lo, hi, nil
+}
+
+// vlanRangeString shows consecutive VLANs as a range
+func vlanRangeString(list []int) string {
+	var s []string
+	for i := 0; i < len(list); i++ {
+		j := i
+		for j+1 < len(list) && list[j+1] == list[j]+1 {
+			j++
+		}
+		if j > i {
+			s = append(s, fmt.Sprintf("%d-%d", list[i], list[j]))
+		} else {
+			s = append(s, strconv.Itoa(list[i]))
+		}
+		i = j
+	}
+	return strings.Join(s, ",")
+}
+
+// parseMatchPort reads a port, the Flow Profile matches a single one so a range must start and end on it
+func parseMatchPort(key, value string) (int, error) {
+	lo, hi, err := parseRange(value, 0, 65535)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", key, err)
+	}
+	if hi != lo {
+		return 0, fmt.Errorf("%s=%s: a Flow Profile matches a single port, port ranges are not supported, use a Flow Profile per port", key, value)
+	}
+	return lo, nil
+}
+
+// splitMask separates an address from the /mask or /len following it
+func splitMask(value string) (string, string) {
+	i := strings.Index(value, "/")
+	if i < 0 {
+		return value, ""
+	}
+	return value[:i], value[i+1:]
+}
+
+// parseMatchIP sets the IPv4 address and dotted mask, or the IPv6 address and prefix length, of the source or destination
+func parseMatchIP(m *flowMatch, key, value string) error {
+	addr, mask := splitMask(value)
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("%s: %q is not an IP address", key, addr)
+	}
+	if ip.To4() == nil {
+		n := 0
+		if mask != "" {
+			var err error
+			n, err = parseFrameInt(key+" prefix length", mask, 1, 128)
+			if err != nil {
+				return err
+			}
+		}
+		if key == "src" {
+			if m.IPv6Src != "" {
+				return fmt.Errorf("%s is given twice", key)
+			}
+			m.IPv6Src, m.IPv6SrcLen = addr, n
+		} else {
+			if m.IPv6Dst != "" {
+				return fmt.Errorf("%s is given twice", key)
+			}
+			m.IPv6Dst, m.IPv6DstLen = addr, n
+		}
+		return nil
+	}
+	// the OLT takes a dotted mask, a prefix length is converted
+	if mask != "" && !strings.Contains(mask, ".") {
+		n, err := parseFrameInt(key+" prefix length", mask, 0, 32)
+		if err != nil {
+			return err
+		}
+		mask = net.IP(net.CIDRMask(n, 32)).String()
+	} else if mask != "" && net.ParseIP(mask).To4() == nil {
+		return fmt.Errorf("%s: %q is not an IPv4 mask", key, mask)
+	}
+	if key == "src" {
+		if m.IPSrc != "" {
+			return fmt.Errorf("%s is given twice", key)
+		}
+		m.IPSrc, m.IPSrcMask = addr, mask
+	} else {
+		if m.IPDst != "" {
+			return fmt.Errorf("%s is given twice", key)
+		}
+		m.IPDst, m.IPDstMask = addr, mask
+	}
+	return nil
+}
+
+// ipv4MaskString shows a contiguous mask as a prefix length
+func ipv4MaskString(mask string) string {
+	ip := net.ParseIP(mask).To4()
+	if ip == nil {
+		return mask
+	}
+	ones, bits := net.IPMask(ip).Size()
+	if bits == 0 {
+		return mask
+	}
+	return strconv.Itoa(ones)
+}
+
+// parseMatchSection reads the terms of one direction, every criterion not given is undefined
+func parseMatchSection(terms []string) (*flowMatch, error) {
+	m := newFlowMatch()
+	var err error
+	// sport and dport take the protocol from ipproto, which may follow them
+	var sport, dport string
+	for _, term := range terms {
+		switch strings.ToLower(term) {
+		case "any":
+			m.Any = true
+			continue
+		case "vlanprofile":
+			m.VlanProfile = true
+			continue
+		case "none":
+			if len(terms) > 1 {
+				return nil, fmt.Errorf("none cannot be combined with other criteria")
+			}
+			continue
+		}
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", term)
+		}
+		key, value := strings.ToLower(kv[0]), kv[1]
+		switch key {
+		case "dmac", "smac":
+			addr, mask := splitMask(value)
+			if _, err = net.ParseMAC(addr); err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			if mask != "" {
+				if _, err = net.ParseMAC(mask); err != nil {
+					return nil, fmt.Errorf("%s mask: %v", key, err)
+				}
+			}
+			if key == "dmac" {
+				m.MacDst, m.MacDstMask = addr, mask
+			} else {
+				m.MacSrc, m.MacSrcMask = addr, mask
+			}
+		case "cvlan":
+			m.CVlans, err = parseVlanList(value)
+		case "svlan":
+			m.SVlans, err = parseVlanList(value)
+		case "pcp", "cpcp":
+			m.CPcp, err = parseFrameInt(key, value, 0, 7)
+		case "spcp":
+			m.SPcp, err = parseFrameInt(key, value, 0, 7)
+		case "ethertype":
+			if v, ok := ethertypeNames[strings.ToLower(value)]; ok {
+				m.Ethertype = v
+			} else {
+				m.Ethertype, err = parseFrameInt(key, value, 0, 65535)
+			}
+		case "ipproto", "proto":
+			if v, ok := ipProtocolNames[strings.ToLower(value)]; ok {
+				m.IPProtocol = v
+			} else {
+				m.IPProtocol, err = parseFrameInt(key, value, 0, 255)
+			}
+		case "src", "dst":
+			err = parseMatchIP(m, key, value)
+		case "dscp":
+			m.IPDscp, err = parseDscp(value)
+		case "csc":
+			m.IPCsc, err = parseFrameInt(key, value, 0, 7)
+		case "dp":
+			m.IPDropPrecedence, err = parseFrameInt(key, value, 0, 3)
+		case "sport":
+			sport = value
+		case "dport":
+			dport = value
+		case "tcp-sport":
+			m.TCPSrcPort, err = parseMatchPort(key, value)
+		case "tcp-dport":
+			m.TCPDstPort, err = parseMatchPort(key, value)
+		case "udp-sport":
+			m.UDPSrcPort, err = parseMatchPort(key, value)
+		case "udp-dport":
+			m.UDPDstPort, err = parseMatchPort(key, value)
+		default:
+			return nil, fmt.Errorf("unknown key %q", kv[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range []struct {
+		key, value string
+		tcp, udp   *int
+	}{
+		{"sport", sport, &m.TCPSrcPort, &m.UDPSrcPort},
+		{"dport", dport, &m.TCPDstPort, &m.UDPDstPort},
+	} {
+		if p.value == "" {
+			continue
+		}
+		port, err := parseMatchPort(p.key, p.value)
+		if err != nil {
+			return nil, err
+		}
+		switch m.IPProtocol {
+		case ipProtocolTcp:
+			*p.tcp = port
+		case ipProtocolUdp:
+			*p.udp = port
+		default:
+			return nil, fmt.Errorf("%s needs ipproto=tcp or ipproto=udp, or use tcp-%s or udp-%s", p.key, p.key, p.key)
+		}
+	}
+	return m, nil
+}
+
+// parseMatchExpression reads the us: and ds: sections separated by ;, a direction not given is nil
+func parseMatchExpression(expr string) (*flowMatch, *flowMatch, error) {
+	var us, ds *flowMatch
+	for _, section := range strings.Split(expr, ";") {
+		section = strings.TrimSpace(section)
+		if section == "" {
+			continue
+		}
+		i := strings.Index(section, ":")
+		if i < 0 {
+			return nil, nil, fmt.Errorf("%q does not start with us: or ds:", section)
+		}
+		m, err := parseMatchSection(strings.Fields(section[i+1:]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", strings.TrimSpace(section[:i]), err)
+		}
+		switch strings.ToLower(strings.TrimSpace(section[:i])) {
+		case "us":
+			if us != nil {
+				return nil, nil, fmt.Errorf("us: is given twice")
+			}
+			us = m
+		case "ds":
+			if ds != nil {
+				return nil, nil, fmt.Errorf("ds: is given twice")
+			}
+			ds = m
+		default:
+			return nil, nil, fmt.Errorf("unknown direction %q, expected us: or ds:", section[:i])
+		}
+	}
+	if us == nil && ds == nil {
+		return nil, nil, gopon.ErrNotInput
+	}
+	return us, ds, nil
+}
+
+// expression renders the criteria in the syntax parseMatchSection reads
+func (m *flowMatch) expression() string {
+	var s []string
+	add := func(format string, a ...interface{}) {
+		s = append(s, fmt.Sprintf(format, a...))
+	}
+	if m.Any {
+		add("any")
+	}
+	if m.VlanProfile {
+		add("vlanprofile")
+	}
+	if m.MacDst != "" {
+		add("dmac=%s", maskedString(m.MacDst, m.MacDstMask))
+	}
+	if m.MacSrc != "" {
+		add("smac=%s", maskedString(m.MacSrc, m.MacSrcMask))
+	}
+	if len(m.CVlans) > 0 {
+		add("cvlan=%s", vlanRangeString(m.CVlans))
+	}
+	if len(m.SVlans) > 0 {
+		add("svlan=%s", vlanRangeString(m.SVlans))
+	}
+	if m.CPcp >= 0 {
+		add("pcp=%d", m.CPcp)
+	}
+	if m.SPcp >= 0 {
+		add("spcp=%d", m.SPcp)
+	}
+	if m.Ethertype >= 0 {
+		add("ethertype=%s", nameOf(ethertypeNames, m.Ethertype, "0x%04x"))
+	}
+	if m.IPProtocol >= 0 {
+		add("ipproto=%s", nameOf(ipProtocolNames, m.IPProtocol, "%d"))
+	}
+	if m.IPSrc != "" {
+		add("src=%s", maskedString(m.IPSrc, ipv4MaskString(m.IPSrcMask)))
+	}
+	if m.IPv6Src != "" {
+		add("src=%s", prefixString(m.IPv6Src, m.IPv6SrcLen))
+	}
+	if m.IPDst != "" {
+		add("dst=%s", maskedString(m.IPDst, ipv4MaskString(m.IPDstMask)))
+	}
+	if m.IPv6Dst != "" {
+		add("dst=%s", prefixString(m.IPv6Dst, m.IPv6DstLen))
+	}
+	if m.IPDscp >= 0 {
+		add("dscp=%s", dscpString(m.IPDscp))
+	}
+	if m.IPCsc >= 0 {
+		add("csc=%d", m.IPCsc)
+	}
+	if m.IPDropPrecedence >= 0 {
+		add("dp=%d", m.IPDropPrecedence)
+	}
+	// ports of the protocol matched are shown short, any other keeps its protocol
+	ports := []struct {
+		key      string
+		port     int
+		protocol int
+	}{
+		{"sport", m.TCPSrcPort, ipProtocolTcp},
+		{"dport", m.TCPDstPort, ipProtocolTcp},
+		{"sport", m.UDPSrcPort, ipProtocolUdp},
+		{"dport", m.UDPDstPort, ipProtocolUdp},
+	}
+	for _, p := range ports {
+		if p.port < 0 {
+			continue
+		}
+		if p.protocol == m.IPProtocol {
+			add("%s=%d", p.key, p.port)
+		} else {
+			add("%s-%s=%d", nameOf(ipProtocolNames, p.protocol, "%d"), p.key, p.port)
+		}
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, " ")
+}
+
+// matchExpression renders both directions of the Flow Profile as one line
+func matchExpression(fp *gopon.FlowProfile) string {
+	return fmt.Sprintf("us: %s; ds: %s", flowMatchUs(fp).expression(), flowMatchDs(fp).expression())
+}
+
+// applyMatchExpression replaces the criteria of the directions in the expression, leaving the others
+func applyMatchExpression(fp *gopon.FlowProfile, expr string) error {
+	us, ds, err := parseMatchExpression(expr)
+	if err != nil {
+		return err
+	}
+	if us != nil {
+		setFlowMatchUs(fp, us)
+	}
+	if ds != nil {
+		setFlowMatchDs(fp, ds)
+	}
+	return nil
+}
+
+var MatchExprHeaders = []string{
+	"Flow Profile",
+	"Match",
+}
+
+func tabwriteMatchExpressions(list []*gopon.FlowProfile) {
+	var rows [][]string
+	for _, fp := range list {
+		rows = append(rows, []string{fp.Name, matchExpression(fp)})
+	}
+	tabwriteTable("Flow Profile Match Criteria", MatchExprHeaders, rows)
+}
+
+// modifyMatchExpression shows the criteria of the Flow Profile and replaces them with an expression, empty input keeps them
+func modifyMatchExpression(fp *gopon.FlowProfile) error {
+	fmt.Printf("++ Match criteria: %s\n", matchExpression(fp))
+	for {
+		fmt.Print(">> Provide a match expression to replace them, ? for the syntax, or leave empty to keep them:\n>> ")
+		input := strings.TrimSpace(readFromStdin())
+		switch input {
+		case "":
+			return nil
+		case "?":
+			for _, v := range MatchExprKeys {
+				fmt.Printf("++ %s\n", v)
+			}
+			continue
+		}
+		err := applyMatchExpression(fp, input)
+		if err == nil {
+			fmt.Printf("++ Match criteria: %s\n", matchExpression(fp))
+			return nil
+		}
+		fmt.Printf("!! %v\n", err)
+	}
+}
+
+// matchCommand runs `match`, showing the criteria of Flow Profiles as expressions, or replacing those of one and posting it
+func matchCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("match", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Println("match [flow_profile] [\"us: ...; ds: ...\"]")
+		fmt.Println("Match expression terms:")
+		for _, v := range MatchExprKeys {
+			fmt.Printf("  %s\n", v)
+		}
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fpl, err := olt.GetFlowProfiles()
+		if err != nil {
+			return err
+		}
+		tabwriteMatchExpressions(fpl.Entry)
+		return nil
+	}
+	p, err := olt.GetFlowProfileByName(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fp := *p
+	if fs.NArg() == 1 {
+		tabwriteMatchExpressions([]*gopon.FlowProfile{&fp})
+		return nil
+	}
+	if fp.IsUsed() {
+		return fmt.Errorf("Flow Profile %s is in use and cannot be modified", fp.Name)
+	}
+	err = applyMatchExpression(&fp, strings.Join(fs.Args()[1:], " "))
+	if err != nil {
+		return err
+	}
+	tabwriteMatchExpressions([]*gopon.FlowProfile{&fp})
+	err = olt.DeleteFlowProfile(fp.Name)
+	if err != nil {
+		return err
+	}
+	return olt.PostFlowProfile(fp.GenerateJson())
+}
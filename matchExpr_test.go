@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// directionString renders the match of a direction as an expression, a direction not given as -
+func directionString(m *flowMatch) string {
+	if m == nil {
+		return "-"
+	}
+	return m.expression()
+}
+
+func TestParseMatchExpression(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{
+			name: "single port",
+			expr: "us: cvlan=100-110 pcp=5 ipproto=udp dport=5060 dscp=ef; ds: any",
+			want: "us: cvlan=100-110 pcp=5 ipproto=udp dscp=ef dport=5060; ds: any",
+		},
+		{
+			name: "sport before ipproto",
+			expr: "us: sport=68 ipproto=udp dport=67",
+			want: "us: ipproto=udp sport=68 dport=67; ds: -",
+		},
+		{
+			name: "ports of the other protocol keep it",
+			expr: "ds: ipproto=tcp tcp-dport=80 udp-dport=53",
+			want: "us: -; ds: ipproto=tcp dport=80 udp-dport=53",
+		},
+		{
+			name: "range of a single port",
+			expr: "us: udp-sport=1-1",
+			want: "us: udp-sport=1; ds: -",
+		},
+		{
+			name: "addresses and classes",
+			expr: "us: src=10.0.0.0/24 dst=2001:db8::/32 ethertype=ipv4 dscp=af21 csc=2 dp=1 dmac=00:11:22:33:44:55/ff:ff:ff:00:00:00",
+			want: "us: dmac=00:11:22:33:44:55/ff:ff:ff:00:00:00 ethertype=ipv4 src=10.0.0.0/24 dst=2001:db8::/32 dscp=af21 csc=2 dp=1; ds: -",
+		},
+		{
+			name: "none and vlanprofile",
+			expr: "us: none; ds: vlanprofile svlan=200",
+			want: "us: none; ds: vlanprofile svlan=200",
+		},
+	}
+	for _, tt := range tests {
+		us, ds, err := parseMatchExpression(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := "us: " + directionString(us) + "; ds: " + directionString(ds); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"empty", " ; "},
+		{"no direction", "cvlan=100"},
+		{"unknown direction", "up: any"},
+		{"direction twice", "us: any; us: none"},
+		{"none combined", "us: none any"},
+		{"not key=value", "us: cvlan"},
+		{"unknown key", "us: vlan=100"},
+		{"port without protocol", "us: dport=80"},
+		{"port of icmp", "us: ipproto=icmp dport=80"},
+		{"port out of range", "us: udp-dport=65536"},
+		{"reversed range", "us: udp-dport=10-5"},
+		{"port range", "us: cvlan=100-110 pcp=5 ipproto=udp dport=5060-5061 dscp=ef; ds: any"},
+		{"tcp port range", "ds: tcp-sport=1-2"},
+		{"pcp out of range", "us: pcp=8"},
+		{"bad dscp", "us: dscp=af51"},
+		{"bad mac", "us: dmac=00:11"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseMatchExpression(tt.expr)
+		if err == nil {
+			t.Errorf("%s: %q parsed", tt.name, tt.expr)
+		}
+	}
+	if _, _, err := parseMatchExpression(""); err != gopon.ErrNotInput {
+		t.Errorf("empty: err = %v, want %v", err, gopon.ErrNotInput)
+	}
+}
+
+// TestMatchExpressionRoundTrip applies each expression to a Flow Profile and reads it back the same way
+func TestMatchExpressionRoundTrip(t *testing.T) {
+	exprs := []string{
+		"us: cvlan=100-110 pcp=5 ipproto=udp dscp=ef dport=5060; ds: any",
+		"us: ipproto=udp sport=68 dport=67; ds: ipproto=udp sport=67 dport=68",
+		"us: dmac=01:00:5e:00:00:00/ff:ff:ff:80:00:00 ethertype=ipv4 ipproto=igmp; ds: none",
+		"us: vlanprofile; ds: svlan=200,300-302 spcp=3 ethertype=0x88cc",
+		"us: src=10.0.0.0/24 dst=10.0.1.1 dscp=cs5 csc=5; ds: ipproto=tcp src=2001:db8::/32 dport=443 udp-dport=53",
+	}
+	for _, expr := range exprs {
+		var fp gopon.FlowProfile
+		err := applyMatchExpression(&fp, expr)
+		if err != nil {
+			t.Errorf("%q: %v", expr, err)
+			continue
+		}
+		if got := matchExpression(&fp); got != expr {
+			t.Errorf("round trip of %q gives %q", expr, got)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// OnuCommandList are the subcommands of `onu`
+var OnuCommandList = []string{
+	"show <serial|slot/port/onu>: everything the Service Profiles of the ONU apply to it",
+	"service [-dry-run] add|remove|swap <serial|slot/port/onu> <service...>: change the Service Profiles of the ONU after checking them",
+	"import [-dry-run] [-batch n] [-results file] <rollout.csv>: authorize ONUs and assign their Service Profiles from a rollout file",
+}
+
+// onuCommand dispatches the `onu` subcommands
+func onuCommand(olt *gopon.LumiaOlt, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("onu requires a subcommand, one of:\n  %s", strings.Join(OnuCommandList, "\n  "))
+	}
+	switch strings.ToLower(args[0]) {
+	case "show":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: onu %s", OnuCommandList[0])
+		}
+		return onuShowCommand(olt, args[1])
+	case "service":
+		return onuServiceCommand(olt, args[1:])
+	case "import":
+		return onuImportCommand(olt, args[1:])
+	}
+	return fmt.Errorf("unknown onu subcommand %s, one of:\n  %s", args[0], strings.Join(OnuCommandList, "\n  "))
+}
+
+// normalizeOnuID returns the interface (0/x/y) or serial number the ONU is registered with,
+// a port/onu pair is on slot 0 and a serial of 8 characters has the vendor ID left off
+func normalizeOnuID(id string) string {
+	id = strings.TrimSpace(id)
+	if strings.Contains(id, "/") {
+		if strings.Count(id, "/") == 1 {
+			return "0/" + id
+		}
+		return id
+	}
+	sn := strings.ToUpper(id)
+	if len(sn) == 8 {
+		sn = "ISKT" + sn
+	}
+	return sn
+}
+
+// findOnu re-reads the registry and returns a copy of the entry of the ONU by serial number or interface
+func findOnu(olt *gopon.LumiaOlt, id string) (*gopon.OnuRegister, error) {
+	err := olt.UpdateOnuRegistry()
+	if err != nil {
+		return nil, err
+	}
+	id = normalizeOnuID(id)
+	var reg *gopon.OnuRegister
+	if strings.Contains(id, "/") {
+		reg, err = olt.GetOnuRegisterByIntf(id)
+	} else {
+		reg, err = olt.GetOnuRegisterBySn(id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ONU %s: %v", id, err)
+	}
+	onu := *reg
+	onu.Services = append([]string(nil), reg.Services...)
+	return &onu, nil
+}
+
+// onuService is a Service Profile of an ONU with the sub-profiles it references, nil where not set or not found
+type onuService struct {
+	Service      *gopon.ServiceProfile
+	Flow         *gopon.FlowProfile
+	Vlan         *gopon.VlanProfile
+	OnuFlow      *gopon.OnuFlowProfile
+	Tcont        *gopon.OnuTcontProfile
+	OnuVlan      *gopon.OnuVlanProfile
+	Security     *gopon.SecurityProfile
+	Multicast    *gopon.IgmpProfile
+	OnuMulticast *gopon.OnuIgmpProfile
+}
+
+// onuConfig is everything that applies to one ONU
+type onuConfig struct {
+	Onu      *gopon.OnuRegister
+	Services []*onuService
+	// Missing lists the Service Profiles and sub-profiles that are referenced but do not exist
+	Missing []string
+}
+
+// profileTables holds copies of every profile table, by name, to resolve Service Profiles without a request each
+type profileTables struct {
+	*flowProfileSet
+	Tconts        map[string]*gopon.OnuTcontProfile
+	OnuVlans      map[string]*gopon.OnuVlanProfile
+	Securities    map[string]*gopon.SecurityProfile
+	Multicasts    map[string]*gopon.IgmpProfile
+	OnuMulticasts map[string]*gopon.OnuIgmpProfile
+}
+
+func getProfileTables(olt *gopon.LumiaOlt) (*profileTables, error) {
+	set, err := getFlowProfileSet(olt)
+	if err != nil {
+		return nil, err
+	}
+	t := &profileTables{
+		flowProfileSet: set,
+		Tconts:         make(map[string]*gopon.OnuTcontProfile),
+		OnuVlans:       make(map[string]*gopon.OnuVlanProfile),
+		Securities:     make(map[string]*gopon.SecurityProfile),
+		Multicasts:     make(map[string]*gopon.IgmpProfile),
+		OnuMulticasts:  make(map[string]*gopon.OnuIgmpProfile),
+	}
+	otpl, err := olt.GetOnuTcontProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range otpl.Entry {
+		p := *v
+		t.Tconts[p.Name] = &p
+	}
+	ovpl, _, err := olt.GetOnuVlanProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ovpl.Entry {
+		t.OnuVlans[v.Name] = cloneOnuVlanProfile(v)
+	}
+	secl, err := olt.GetSecurityProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range secl.Entry {
+		p := *v
+		t.Securities[p.Name] = &p
+	}
+	mpl, err := olt.GetMulticastProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range mpl.Entry {
+		p := *v
+		t.Multicasts[p.Name] = &p
+	}
+	ompl, err := olt.GetOnuMulticastProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range ompl.Entry {
+		p := *v
+		t.OnuMulticasts[p.Name] = &p
+	}
+	return t, nil
+}
+
+// service resolves a Service Profile to its sub-profiles, returning the references that were not found
+func (t *profileTables) service(name string) (*onuService, []string) {
+	var missing []string
+	var sp *gopon.ServiceProfile
+	for _, v := range t.Services {
+		if v.Name == name {
+			sp = v
+		}
+	}
+	if sp == nil {
+		return nil, []string{"Service Profile " + name}
+	}
+	s := &onuService{Service: sp}
+	// a reference is missing when it names a profile the table does not have
+	ref := func(kind, name string, ok bool) {
+		if name != "" && !ok {
+			missing = append(missing, fmt.Sprintf("%s Profile %s of %s", kind, name, sp.Name))
+		}
+	}
+	var ok bool
+	s.Flow, ok = t.Flows[sp.FlowProfileName]
+	ref("Flow", sp.FlowProfileName, ok)
+	s.Vlan, ok = t.Vlans[sp.VlanProfileName]
+	ref("VLAN", sp.VlanProfileName, ok)
+	s.OnuFlow, ok = t.OnuFlows[sp.OnuFlowProfileName]
+	ref("ONU Flow", sp.OnuFlowProfileName, ok)
+	s.Tcont, ok = t.Tconts[sp.OnuTcontProfileName]
+	ref("ONU T-CONT", sp.OnuTcontProfileName, ok)
+	s.OnuVlan, ok = t.OnuVlans[sp.OnuVlanProfileName]
+	ref("ONU VLAN", sp.OnuVlanProfileName, ok)
+	s.Security, ok = t.Securities[sp.SecurityProfileName]
+	ref("Security", sp.SecurityProfileName, ok)
+	s.Multicast, ok = t.Multicasts[sp.MulticastProfileName]
+	ref("Multicast", sp.MulticastProfileName, ok)
+	s.OnuMulticast, ok = t.OnuMulticasts[sp.OnuMulticastProfileName]
+	ref("ONU Multicast", sp.OnuMulticastProfileName, ok)
+	return s, missing
+}
+
+// getOnuConfig resolves every Service Profile of the ONU
+func getOnuConfig(t *profileTables, onu *gopon.OnuRegister) *onuConfig {
+	c := &onuConfig{Onu: onu}
+	for _, name := range onu.Services {
+		s, missing := t.service(name)
+		c.Missing = append(c.Missing, missing...)
+		if s != nil {
+			c.Services = append(c.Services, s)
+		}
+	}
+	return c
+}
+
+// tcontEntries lists the T-CONT and Virtual GEM Port of each service, for the collision checks
+func (c *onuConfig) tcontEntries() []*onuTcontEntry {
+	var entries []*onuTcontEntry
+	for _, s := range c.Services {
+		entries = append(entries, &onuTcontEntry{
+			Interface:    c.Onu.Interface,
+			SerialNumber: c.Onu.SerialNumber,
+			Service:      s.Service.Name,
+			VirtGemPort:  s.Service.OnuVirtGemPortID,
+			Tcont:        s.Tcont,
+		})
+	}
+	return entries
+}
+
+func nameOrDash(name string) string {
+	if name == "" {
+		return "-"
+	}
+	return name
+}
+
+// terminationPointString shows where on the ONU the service terminates
+func terminationPointString(sp *gopon.ServiceProfile) string {
+	tp := gopon.ConvertOnuTPToString(sp.OnuTpType)
+	if tp == "UNI" {
+		return fmt.Sprintf("UNI %d", gopon.ConvertOnuTPUniBitMapToInt(sp.OnuTpUniBitMap))
+	}
+	return nameOrDash(tp)
+}
+
+// markingString describes a PCP or DSCP marking: none(1) keeps it, copy(2) derives it from the other field, userValue(3) sets it
+func markingString(field string, markType, value int, from string) string {
+	switch markType {
+	case 2:
+		return fmt.Sprintf("%s from %s", field, from)
+	case 3:
+		return fmt.Sprintf("%s %d", field, value)
+	}
+	return field + " kept"
+}
+
+func rateString(cdr, pdr int) string {
+	return fmt.Sprintf("%s/%s", formatKbps(cdr), formatKbps(pdr))
+}
+
+var OnuServiceHeaders = []string{
+	"Service",
+	"Termination",
+	"GEM",
+	"Flow",
+	"VLAN",
+	"ONU Flow",
+	"T-CONT",
+	"ONU VLAN",
+	"Security",
+	"Multicast",
+	"ONU Multicast",
+}
+
+var OnuTaggingHeaders = []string{
+	"Service",
+	"C-VID",
+	"S-VID",
+	"Flow Match",
+	"ONU Flow Match",
+	"ONU VLAN Rules",
+}
+
+var OnuRateHeaders = []string{
+	"Service",
+	"Us CDR/PDR",
+	"Ds CDR/PDR",
+	"ONU Us CDR/PDR",
+	"T-CONT",
+	"Ds Queue",
+	"Us Marking",
+	"Ds Marking",
+}
+
+var OnuSecurityHeaders = []string{
+	"Service",
+	"MAC Limit",
+	"Port Security",
+	"IPSG v4/v6",
+	"Storm Control",
+	"App Rate Limits",
+	"DHCP RA",
+	"DHCPv6 RA",
+	"IGMP",
+}
+
+// tabwriteOnuConfig shows the services, tagging, rates and security of the ONU and warns of what does not resolve
+func tabwriteOnuConfig(c *onuConfig) {
+	var services, tagging, rates, security [][]string
+	var tcontMax int
+	for _, s := range c.Services {
+		sp := s.Service
+		services = append(services, []string{
+			sp.Name,
+			terminationPointString(sp),
+			fmt.Sprintf("%d", sp.OnuVirtGemPortID),
+			nameOrDash(sp.FlowProfileName),
+			nameOrDash(sp.VlanProfileName),
+			nameOrDash(sp.OnuFlowProfileName),
+			nameOrDash(sp.OnuTcontProfileName),
+			nameOrDash(sp.OnuVlanProfileName),
+			nameOrDash(sp.SecurityProfileName),
+			nameOrDash(sp.MulticastProfileName),
+			nameOrDash(sp.OnuMulticastProfileName),
+		})
+		tag := []string{sp.Name, "-", "-", "-", "-", "-"}
+		if s.Vlan != nil {
+			if list := flowVlans(s.Vlan.CVid); len(list) > 0 {
+				tag[1] = vlanRangeString(list)
+			}
+			tag[2] = intString(s.Vlan.SVid)
+		}
+		if s.Flow != nil {
+			tag[3] = "us: " + flowMatchUs(s.Flow).expression()
+		}
+		if s.OnuFlow != nil {
+			tag[4] = onuFlowMatch(s.OnuFlow).expression()
+		}
+		if s.OnuVlan != nil {
+			var rules []string
+			for _, r := range sortedOnuVlanRules(s.OnuVlan) {
+				rules = append(rules, fmt.Sprintf("%d: %s => %s", r.RuleID, r.GetMatchCriteriaString(), r.GetActionListString()))
+			}
+			if len(rules) > 0 {
+				tag[5] = strings.Join(rules, "; ")
+			}
+		}
+		tagging = append(tagging, tag)
+		rate := []string{sp.Name, "-", "-", "-", "-", "-", "-", "-"}
+		if s.Flow != nil {
+			fp := s.Flow
+			rate[1] = rateString(fp.UsCdr, fp.UsPdr)
+			rate[2] = rateString(fp.DsCdr, fp.DsPdr)
+			rate[5] = fmt.Sprintf("%d %s", fp.DsQueuingPriority, fp.GetSchedulingMode())
+			rate[6] = markingString("PCP", fp.UsMarkPcp, fp.UsMarkPcpValue, "DSCP") + ", " + markingString("DSCP", fp.UsMarkDscp, fp.UsMarkDscpValue, "PCP")
+			rate[7] = markingString("PCP", fp.DsMarkPcp, fp.DsMarkPcpValue, "DSCP") + ", " + markingString("DSCP", fp.DsMarkDscp, fp.DsMarkDscpValue, "PCP")
+		}
+		if s.OnuFlow != nil {
+			rate[3] = rateString(s.OnuFlow.UsCdr, s.OnuFlow.UsPdr)
+		}
+		if s.Tcont != nil {
+			t := s.Tcont
+			rate[4] = fmt.Sprintf("ID %d type %d F/A/M %s/%s/%s", t.TcontID, t.TcontType, formatKbps(t.FixedDataRate), formatKbps(t.AssuredDataRate), formatKbps(t.MaxDataRate))
+			tcontMax += t.MaxDataRate
+		}
+		rates = append(rates, rate)
+		sec := []string{sp.Name, "-", "-", "-", "-", "-", enabledString(sp.DhcpRa), enabledString(sp.Dhcpv6Ra), "-"}
+		if s.Security != nil {
+			p := s.Security
+			sec[1] = fmt.Sprintf("%d", p.GetMacLimit())
+			sec[2] = enabledString(p.PortSecurity)
+			sec[3] = fmt.Sprintf("%s/%s", enabledString(p.IPSg), enabledString(p.IPSgIpv6))
+			sec[4] = p.GetStormControlString()
+			sec[5] = p.GetAppRateLimitString()
+		}
+		if s.Multicast != nil {
+			sec[8] = fmt.Sprintf("snooping %v, proxy %v, fast leave %v", s.Multicast.GetIgmpSnooping(), s.Multicast.GetIgmpProxy(), s.Multicast.GetFastLeave())
+			if s.OnuMulticast != nil {
+				sec[8] += fmt.Sprintf(", ONU %s GEM %d", s.OnuMulticast.GetMode(), s.OnuMulticast.GetGEMPort())
+			}
+		}
+		security = append(security, sec)
+	}
+	fmt.Printf("++ ONU %s at %s has %d Service Profiles\n", c.Onu.SerialNumber, c.Onu.Interface, len(c.Onu.Services))
+	if len(services) == 0 {
+		return
+	}
+	tabwriteTable("Service Profiles", OnuServiceHeaders, services)
+	tabwriteTable("VLAN Tagging and Classification", OnuTaggingHeaders, tagging)
+	tabwriteTable("Rates and Marking", OnuRateHeaders, rates)
+	tabwriteTable("Security and Multicast", OnuSecurityHeaders, security)
+	fmt.Printf("++ Upstream T-CONT maximum of the ONU: %s\n", formatKbps(tcontMax))
+}
+
+// onuWarnings lists the references that do not resolve and the T-CONT ID and Virtual GEM Port collisions of the ONU
+func onuWarnings(c *onuConfig) []string {
+	var out []string
+	for _, m := range c.Missing {
+		out = append(out, fmt.Sprintf("%s does not exist", m))
+	}
+	for _, col := range findOnuCollisions(c.tcontEntries()) {
+		out = append(out, fmt.Sprintf("%s %d is used by %s", col.Kind, col.Value, strings.Join(col.Services, ", ")))
+	}
+	return out
+}
+
+// onuShowCommand runs `onu show`, the consolidated view of one ONU
+func onuShowCommand(olt *gopon.LumiaOlt, id string) error {
+	onu, err := findOnu(olt, id)
+	if err != nil {
+		return err
+	}
+	t, err := getProfileTables(olt)
+	if err != nil {
+		return err
+	}
+	c := getOnuConfig(t, onu)
+	tabwriteOnuConfig(c)
+	for _, w := range onuWarnings(c) {
+		fmt.Printf("!! %s\n", w)
+	}
+	return nil
+}
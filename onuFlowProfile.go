@@ -15,7 +15,11 @@ func displayOnuFlowProfiles(olt *gopon.LumiaOlt) error {
 	if err != nil {
 		return err
 	}
-	ofpl.Tabwrite()
+	l := newProfileListing("onuflow", "ONU Flow Profile List", gopon.OnuFlowProfileHeaders)
+	for _, ofp := range ofpl.Entry {
+		l.addParams(ofp.Name, ofp.Usage, ofp.ListEssentialParams())
+	}
+	tabwriteListing(l)
 	return nil
 }
 
@@ -155,6 +159,13 @@ func modifyOnuFlowProfileHandler(olt *gopon.LumiaOlt, ofp *gopon.OnuFlowProfile,
 				fmt.Println("!! Not settable")
 			}
 		}
+		fmt.Print(">> Check the burst size this rate needs? (y/N)\n>> ")
+		if strings.ToLower(sanitizeInput(readFromStdin())) == "y" {
+			err = checkOnuFlowProfileBursts(ofp)
+			if err != nil {
+				return nil, err
+			}
+		}
 	case 4:
 		// UsPdr
 		fmt.Println("++ ONU upstream peak data rate (E-PDR) in kbps. Any rate value can be entered, but is rounded up to the multiple of 64 kbps. Limitation: Peak rate cannot be lower than guaranteed rate")
@@ -171,6 +182,13 @@ func modifyOnuFlowProfileHandler(olt *gopon.LumiaOlt, ofp *gopon.OnuFlowProfile,
 				fmt.Println("!! Not settable")
 			}
 		}
+		fmt.Print(">> Check the burst size this rate needs? (y/N)\n>> ")
+		if strings.ToLower(sanitizeInput(readFromStdin())) == "y" {
+			err = checkOnuFlowProfileBursts(ofp)
+			if err != nil {
+				return nil, err
+			}
+		}
 	case 5:
 		// UsFlowPriority
 		fmt.Println("++ ONU upstream flow priority (0...7)")
@@ -1,11 +1,49 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/lindsaybb/gopon"
 )
 
+const (
+	onuIgmpProfileTable = "msanOnuMulticastProfileTable"
+	onuIgmpProfileEntry = "msanOnuMulticastProfileEntry"
+)
+
+// onuIgmpProfile holds a gopon OnuIgmpProfile read from the raw table, so edits do not point into the gopon tables,
+// with the subscriber limits gopon does not model when the OLT reports them. The allowed group ranges of the
+// channel packages are a table of their own on the ONU (G.988 9.3.27 dynamic access control list), which neither
+// gopon nor the profile entry carry, so they are not offered
+type onuIgmpProfile struct {
+	gopon.OnuIgmpProfile
+	columns reportedColumns
+}
+
+// onuIgmpLimitColumns are looked up in the entries of the ONU multicast profile table, after the attributes of
+// the G.988 multicast operations profile (9.3.27) and multicast subscriber config info (9.3.28) the OLT configures
+var onuIgmpLimitColumns = []rawColumn{
+	{"Max Groups", []string{"MaxSimultaneousGroups", "MaxSimGroups"}},
+	{"Max Bandwidth", []string{"MaxMulticastBandwidth", "MaxMcastBandwidth"}},
+	{"Us IGMP Rate", []string{"UsIgmpRate", "UpstreamIgmpRate"}},
+}
+
+// OnuIgmpProfileEditHeaders lists every editable element of the ONU IGMP Profile
+var OnuIgmpProfileEditHeaders = []string{
+	"Name",
+	"Mode",
+	"Proxy",
+	"Fast-Leave",
+	"UsTci",
+	"DsGem",
+	"Max Groups",
+	"Max Bandwidth",
+	"Us IGMP Rate",
+}
+
 func displayOnuIgmpProfiles(olt *gopon.LumiaOlt) error {
 	var err error
 	var oipl *gopon.OnuIgmpProfileList
@@ -13,11 +51,270 @@ func displayOnuIgmpProfiles(olt *gopon.LumiaOlt) error {
 	if err != nil {
 		return err
 	}
-	oipl.Tabwrite()
+	l := newProfileListing("onumulticast", "ONU IGMP Profile List", gopon.OnuIgmpProfileHeaders)
+	for _, oip := range oipl.Entry {
+		l.addParams(oip.Name, oip.Usage, oip.ListEssentialParams())
+	}
+	tabwriteListing(l)
 	return nil
 }
 
+// getOnuIgmpProfileByName reads the profile from the raw table
+func getOnuIgmpProfileByName(olt *gopon.LumiaOlt, name string) (*onuIgmpProfile, error) {
+	if name == "" {
+		return nil, gopon.ErrNotInput
+	}
+	entries, err := getRawTableEntries(olt, onuIgmpProfileTable, onuIgmpProfileEntry)
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range entries {
+		var p onuIgmpProfile
+		err = json.Unmarshal(raw, &p)
+		if err != nil {
+			return nil, err
+		}
+		if p.Name == name {
+			p.columns, err = findReportedColumns(raw, p.OnuIgmpProfile, onuIgmpLimitColumns)
+			if err != nil {
+				return nil, err
+			}
+			return &p, nil
+		}
+	}
+	return nil, gopon.ErrNotExists
+}
+
+// Copy returns a copy of the profile with a new name and Usage set to 2
+func (p *onuIgmpProfile) Copy(newName string) (*onuIgmpProfile, error) {
+	if newName == "" {
+		return nil, gopon.ErrNotInput
+	}
+	if p.Name == newName {
+		return nil, gopon.ErrExists
+	}
+	np := *p
+	np.Name = newName
+	np.Usage = 2
+	np.columns = p.columns.copy()
+	return &np, nil
+}
+
+// GenerateJson serializes the profile for posting, with the subscriber limits the OLT reported
+func (p *onuIgmpProfile) GenerateJson() (name string, data []byte) {
+	data, err := json.Marshal(p.OnuIgmpProfile)
+	if err != nil {
+		return "", data
+	}
+	data, err = p.columns.merge(data)
+	if err != nil {
+		return "", data
+	}
+	return p.Name, data
+}
+
+// onuIgmpLimitString shows a limit of which 0 is none
+func onuIgmpLimitString(unit string) func(int) string {
+	return func(v int) string {
+		if v == 0 {
+			return "No limit"
+		}
+		return fmt.Sprintf("%d%s", v, unit)
+	}
+}
+
+func (p *onuIgmpProfile) Tabwrite() {
+	proxy := "Disabled"
+	if p.GetProxy() {
+		proxy = "Enabled"
+	}
+	row := []string{
+		p.Name,
+		p.GetMode(),
+		proxy,
+		enabledString(p.IgmpSnoopingFastLeave),
+		fmt.Sprintf("%v", p.GetUsTci()),
+		fmt.Sprintf("%d", p.DsGemPort),
+		p.columns.cell("Max Groups", onuIgmpLimitString("")),
+		p.columns.cell("Max Bandwidth", onuIgmpLimitString(" B/s")),
+		p.columns.cell("Us IGMP Rate", onuIgmpLimitString("/s")),
+	}
+	tabwriteTable("ONU IGMP Profile", OnuIgmpProfileEditHeaders, [][]string{row})
+}
+
 func modifyOnuIgmpProfiles(olt *gopon.LumiaOlt) error {
-	fmt.Println("Modify the ONU IGMP Profile Details placeholder")
+	profType := "ONU IGMP"
+	err := displayOnuIgmpProfiles(olt)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(">> Which %s Profile would you like to Modify?\n>> ", profType)
+	oipName := sanitizeInput(readFromStdin())
+	if oipName == "" {
+		return gopon.ErrNotInput
+	}
+	var oip *onuIgmpProfile
+	oip, err = getOnuIgmpProfileByName(olt, oipName)
+	if err != nil {
+		return err
+	}
+	oip.Tabwrite()
+	fmt.Print(">> Would you like to delete this profile? (y/N)\n>> ")
+	input := strings.ToLower(sanitizeInput(readFromStdin()))
+	if input == "y" {
+		if oip.Usage == 1 {
+			fmt.Println("!! Cannot delete in-use profile.")
+			return nil
+		} else {
+			return olt.DeleteOnuMulticastProfile(oip.Name)
+		}
+	}
+	origName := oip.Name
+	if oip.Usage == 1 {
+		fmt.Println("!! Cannot modify in-use profile")
+		oip, err = modifyOnuIgmpProfileHandler(olt, oip, 0)
+		if err != nil {
+			return err
+		}
+	}
+	arg := getArgFromSelection(OnuIgmpProfileEditHeaders)
+	for {
+		modVal := getIntFromArg(arg, OnuIgmpProfileEditHeaders)
+		oip, err = modifyOnuIgmpProfileHandler(olt, oip, modVal)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(">> Modified %s Profile:\n", profType)
+		oip.Tabwrite()
+		fmt.Print(">> Make further modifications? (y/N)\n>> ")
+		modBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if modBool == "y" {
+			arg = getArgFromSelection(OnuIgmpProfileEditHeaders)
+		} else {
+			break
+		}
+	}
+	fmt.Print(">> Post this modification? (Y/n)\n>> ")
+	postBool := strings.ToLower(sanitizeInput(readFromStdin()))
+	if postBool == "y" || postBool == "" {
+		if oip.Name == origName {
+			err = olt.DeleteOnuMulticastProfile(oip.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return olt.PostOnuMulticastProfile(oip.GenerateJson())
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// getOnuIgmpIntValue prompts for a value in the range min...max, an empty input or the current value keeps it
+func getOnuIgmpIntValue(current, min, max int) (int, error) {
+	fmt.Printf(">> Current value is [%v], provide new value (%d...%d):\n>> ", current, min, max)
+	newInt := sanitizeInput(readFromStdin())
+	if newInt == "" {
+		return current, nil
+	}
+	i, err := strconv.Atoi(newInt)
+	if err != nil {
+		return current, gopon.ErrNotInput
+	}
+	if i != current && (i < min || i > max) {
+		fmt.Println("!! Value out of range, not set")
+		return current, nil
+	}
+	return i, nil
+}
+
+func modifyOnuIgmpProfileHandler(olt *gopon.LumiaOlt, oip *onuIgmpProfile, modVal int) (*onuIgmpProfile, error) {
+	var err error
+	switch modVal {
+	case 0:
+		// Name
+		fmt.Print(">> Provide new name for ONU IGMP Profile\n>> ")
+		newOipName := sanitizeInput(readFromStdin())
+		oip, err = oip.Copy(newOipName)
+		if err != nil {
+			return nil, err
+		}
+	case 1:
+		// Mode
+		fmt.Println("++ Flooding forwards every group to all UNI ports of the ONU, Snooping only to the ports that joined")
+		fmt.Printf(">> Current value is [%v], toggle mode? (Y/n)\n>> ", oip.GetMode())
+		togBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if togBool == "y" || togBool == "" {
+			if oip.GetIgmpSnooping() {
+				oip.SetIgmpFlooding()
+			} else {
+				oip.SetIgmpSnooping()
+			}
+		}
+	case 2:
+		// Proxy
+		fmt.Println("++ The ONU answers queries on behalf of its UNI ports")
+		fmt.Printf(">> Current value is [%v], toggle status? (Y/n)\n>> ", oip.GetProxy())
+		togBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if togBool == "y" || togBool == "" {
+			oip.SetProxy(!oip.GetProxy())
+		}
+	case 3:
+		// Fast-Leave
+		fmt.Println("++ Fast-Leave stops forwarding a group as soon as a Leave is received on the UNI port")
+		fmt.Printf(">> Current value is [%v], toggle status? (Y/n)\n>> ", oip.GetIgmpSnoopingFastLeave())
+		togBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if togBool == "y" || togBool == "" {
+			oip.SetIgmpSnoopingFastLeave(!oip.GetIgmpSnoopingFastLeave())
+		}
+	case 4:
+		// UsTci
+		fmt.Println("++ Tag applied to upstream IGMP messages, provided as a space-separated list of VID (0...4095), PCP (0...7) and Control Mode (0...5)")
+		fmt.Printf(">> Current value is %v, provide new values:\n>> ", oip.GetUsTci())
+		list, err := getIntListFromInput(3)
+		if err != nil {
+			return nil, err
+		}
+		if list == nil {
+			break
+		}
+		if list[0] < 0 || list[0] > 4095 || list[1] < 0 || list[1] > 7 || list[2] < 0 || list[2] > 5 {
+			fmt.Println("!! Value out of range, not set")
+			break
+		}
+		oip.UsIgmpTciVlanID = list[0]
+		oip.UsIgmpTciPcpValue = list[1]
+		oip.UsIgmpTciCtrlMode = list[2]
+	case 5:
+		// DsGem
+		fmt.Println("++ GEM Port carrying the downstream multicast traffic to the ONU, the OLT default is 4000")
+		oip.DsGemPort, err = getOnuIgmpIntValue(oip.DsGemPort, 3800, 4000)
+		if err != nil {
+			return nil, err
+		}
+	case 6, 7, 8:
+		header := OnuIgmpProfileEditHeaders[modVal]
+		if !oip.columns.require(header, onuIgmpProfileTable) {
+			break
+		}
+		switch header {
+		case "Max Groups":
+			fmt.Println("++ Groups a UNI port may join at the same time, 0 for no limit")
+		case "Max Bandwidth":
+			fmt.Println("++ Multicast bandwidth a UNI port may receive in bytes per second, 0 for no limit")
+		case "Us IGMP Rate":
+			fmt.Println("++ Upstream IGMP messages per second, the excess is discarded, 0 for no limit")
+		}
+		max := 2147483647
+		if header == "Max Groups" {
+			max = 65535
+		}
+		v, _ := oip.columns.intValue(header)
+		v, err = getOnuIgmpIntValue(v, 0, max)
+		if err != nil {
+			return nil, err
+		}
+		oip.columns.setInt(header, v)
+	default:
+		fmt.Println("!! Unpexpected input, nothing to modify")
+	}
+	return oip, nil
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// OnuImportHeaders are the columns of a rollout file, a first row starting with "serial" is taken as a header
+var OnuImportHeaders = []string{
+	"Serial",
+	"PON Port",
+	"Services",
+	"Subscriber ID",
+}
+
+// OnuImportResultHeaders are the columns of the results file and the plan shown by -dry-run
+var OnuImportResultHeaders = []string{
+	"Row",
+	"Serial",
+	"PON Port",
+	"Services",
+	"Subscriber ID",
+	"Interface",
+	"Action",
+	"Result",
+	"Error",
+}
+
+// onuImportRow is one ONU of a rollout, the Subscriber ID has no field on the OLT and is carried to the results
+type onuImportRow struct {
+	Row          int
+	SerialNumber string
+	Port         string
+	Services     []string
+	Subscriber   string
+	// Onu is the registry entry before the import, nil when the serial is not registered
+	Onu *gopon.OnuRegister
+	// Interface is where the ONU is or will be registered
+	Interface string
+	Action    string
+	Result    string
+	Err       string
+}
+
+func (r *onuImportRow) fail(format string, a ...interface{}) {
+	r.Action = "none"
+	r.Result = "error"
+	r.Err = fmt.Sprintf(format, a...)
+}
+
+func (r *onuImportRow) record() []string {
+	return []string{
+		strconv.Itoa(r.Row),
+		r.SerialNumber,
+		r.Port,
+		strings.Join(r.Services, ";"),
+		r.Subscriber,
+		r.Interface,
+		r.Action,
+		r.Result,
+		r.Err,
+	}
+}
+
+// splitServiceList splits a cell of Service Profiles on semicolons, pipes or spaces
+func splitServiceList(cell string) []string {
+	return strings.FieldsFunc(cell, func(r rune) bool {
+		return r == ';' || r == '|' || r == ' ' || r == '\t'
+	})
+}
+
+// readOnuImport parses a rollout file, the checks of each row are left to planOnuImport
+func readOnuImport(path string) ([]*onuImportRow, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	var rows []*onuImportRow
+	for {
+		rec, err := cr.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if len(rows) == 0 && len(rec) > 0 && strings.HasPrefix(strings.ToLower(strings.TrimSpace(rec[0])), "serial") {
+			continue
+		}
+		for len(rec) < len(OnuImportHeaders) {
+			rec = append(rec, "")
+		}
+		r := &onuImportRow{
+			Row:          len(rows) + 1,
+			SerialNumber: normalizeOnuID(rec[0]),
+			Port:         strings.TrimSpace(rec[1]),
+			Services:     splitServiceList(rec[2]),
+			Subscriber:   strings.TrimSpace(rec[3]),
+		}
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+// onuImportPort returns the PON port (0/x) and, when the row names one, the ONU interface (0/x/y)
+func onuImportPort(port string) (string, string, error) {
+	p := strings.Split(port, "/")
+	if len(p) == 1 {
+		p = append([]string{"0"}, p...)
+	}
+	if len(p) > 3 || p[0] != "0" {
+		return "", "", fmt.Errorf("PON port %s is not x, 0/x or 0/x/y", port)
+	}
+	for i, v := range p {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || (i == 2 && (n < 1 || n > 128)) {
+			return "", "", fmt.Errorf("PON port %s is not x, 0/x or 0/x/y", port)
+		}
+	}
+	if len(p) == 3 {
+		return strings.Join(p[:2], "/"), strings.Join(p, "/"), nil
+	}
+	return strings.Join(p, "/"), "", nil
+}
+
+// nextFreeOnuIntf returns the first ONU interface of the PON port that is neither registered nor given to an earlier row
+func nextFreeOnuIntf(used map[string]bool, port string) string {
+	for i := 1; i <= 128; i++ {
+		intf := fmt.Sprintf("%s/%d", port, i)
+		if !used[intf] {
+			return intf
+		}
+	}
+	return ""
+}
+
+// planOnuImport checks every row against the registry and the Service Profiles and decides what it changes
+func planOnuImport(olt *gopon.LumiaOlt, t *profileTables, rows []*onuImportRow) {
+	used := make(map[string]bool)
+	for _, reg := range olt.Registration {
+		used[reg.Interface] = true
+	}
+	serials := make(map[string]int)
+	for _, r := range rows {
+		if len(r.SerialNumber) != 12 {
+			r.fail("serial %s is not 8 or 12 characters", r.SerialNumber)
+			continue
+		}
+		if row, ok := serials[r.SerialNumber]; ok {
+			r.fail("serial %s is already on row %d", r.SerialNumber, row)
+			continue
+		}
+		serials[r.SerialNumber] = r.Row
+		port, intf, err := onuImportPort(r.Port)
+		if err != nil {
+			r.fail("%v", err)
+			continue
+		}
+		if len(r.Services) == 0 {
+			r.fail("no Service Profiles")
+			continue
+		}
+		if reg, err := olt.GetOnuRegisterBySn(r.SerialNumber); err == nil {
+			onu := *reg
+			onu.Services = append([]string(nil), reg.Services...)
+			r.Onu = &onu
+		}
+		switch {
+		case r.Onu != nil && ponPortFromIntf(r.Onu.Interface) != port, r.Onu != nil && intf != "" && r.Onu.Interface != intf:
+			r.fail("serial is registered at %s", r.Onu.Interface)
+			continue
+		case r.Onu != nil:
+			r.Interface = r.Onu.Interface
+		case intf != "":
+			if used[intf] {
+				r.fail("%s is already in use", intf)
+				continue
+			}
+			r.Interface = intf
+		default:
+			r.Interface = nextFreeOnuIntf(used, port)
+			if r.Interface == "" {
+				r.fail("no free ONU interface on %s", port)
+				continue
+			}
+		}
+		onu := &gopon.OnuRegister{SerialNumber: r.SerialNumber, Interface: r.Interface}
+		if problems := validateOnuServices(t, onu, r.Services); len(problems) > 0 {
+			r.fail("%s", strings.Join(problems, "; "))
+			continue
+		}
+		used[r.Interface] = true
+		switch {
+		case r.Onu == nil:
+			r.Action = "authorize"
+		case sameServices(r.Onu.Services, r.Services):
+			r.Action = "none"
+		default:
+			r.Action = fmt.Sprintf("update from %s", strings.Join(r.Onu.Services, ";"))
+		}
+		r.Result = "planned"
+	}
+}
+
+// provisionOnuImportRow registers a new ONU or brings the services of a registered one in line with the row,
+// a new ONU whose services fail is deauthorized again
+func provisionOnuImportRow(olt *gopon.LumiaOlt, r *onuImportRow) error {
+	if r.Onu != nil {
+		return applyOnuServices(olt, r.Onu, r.Services)
+	}
+	err := olt.AuthorizeOnuOverride(gopon.NewOnuConfig(r.SerialNumber, r.Interface))
+	if err != nil {
+		return fmt.Errorf("authorizing: %v", err)
+	}
+	fmt.Printf("++ Authorized %s at %s\n", r.SerialNumber, r.Interface)
+	onu := &gopon.OnuRegister{SerialNumber: r.SerialNumber, Interface: r.Interface}
+	err = applyOnuServices(olt, onu, r.Services)
+	if err != nil {
+		// the services were rolled back, take the authorization back too so the row is not left half-provisioned,
+		// DeauthOnuBySn only finds the ONU in the registry it holds
+		olt.Registration = append(olt.Registration, onu)
+		if derr := olt.DeauthOnuBySn(r.SerialNumber); derr != nil {
+			return fmt.Errorf("%v, and deauthorizing it again failed: %v", err, derr)
+		}
+		fmt.Printf("++ Deauthorized %s at %s again\n", r.SerialNumber, r.Interface)
+		return err
+	}
+	return nil
+}
+
+// confirmOnuImportBatch re-reads the registry and checks each provisioned row of a batch landed as planned
+func confirmOnuImportBatch(olt *gopon.LumiaOlt, batch []*onuImportRow) {
+	err := olt.UpdateOnuRegistry()
+	for _, r := range batch {
+		if r.Result != "provisioned" {
+			continue
+		}
+		if err != nil {
+			r.Result = "unconfirmed"
+			r.Err = fmt.Sprintf("reading the registry: %v", err)
+			continue
+		}
+		reg, rerr := olt.GetOnuRegisterBySn(r.SerialNumber)
+		switch {
+		case rerr != nil:
+			r.Result = "error"
+			r.Err = "serial is not in the registry after provisioning"
+		case reg.Interface != r.Interface:
+			r.Result = "error"
+			r.Err = fmt.Sprintf("serial is registered at %s", reg.Interface)
+		case !sameServices(reg.Services, r.Services):
+			r.Result = "error"
+			r.Err = fmt.Sprintf("registry has %s", serviceListString(reg.Services))
+		default:
+			r.Result = "ok"
+		}
+	}
+}
+
+// runOnuImport provisions the planned rows in batches, skipping the rest once a whole batch fails
+func runOnuImport(olt *gopon.LumiaOlt, rows []*onuImportRow, size int) {
+	var pending []*onuImportRow
+	for _, r := range rows {
+		if r.Result == "planned" {
+			pending = append(pending, r)
+		}
+	}
+	for start := 0; start < len(pending); start += size {
+		end := start + size
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+		fmt.Printf("++ Batch %d: rows %d to %d\n", start/size+1, batch[0].Row, batch[len(batch)-1].Row)
+		for _, r := range batch {
+			if r.Action == "none" {
+				r.Result = "provisioned"
+				continue
+			}
+			err := provisionOnuImportRow(olt, r)
+			if err != nil {
+				fmt.Printf("!! Row %d %s: %v\n", r.Row, r.SerialNumber, err)
+				r.Result = "error"
+				r.Err = err.Error()
+				continue
+			}
+			r.Result = "provisioned"
+		}
+		confirmOnuImportBatch(olt, batch)
+		var ok int
+		for _, r := range batch {
+			if r.Result == "ok" {
+				ok++
+			}
+		}
+		fmt.Printf("++ Batch %d: %d of %d confirmed\n", start/size+1, ok, len(batch))
+		if ok == 0 && end < len(pending) {
+			fmt.Println("!! Every row of the batch failed, the remaining rows are skipped")
+			for _, r := range pending[end:] {
+				r.Result = "skipped"
+				r.Err = "an earlier batch failed"
+			}
+			return
+		}
+	}
+}
+
+func writeOnuImportResults(path string, rows []*onuImportRow) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	headers := make([]string, len(OnuImportResultHeaders))
+	for i, h := range OnuImportResultHeaders {
+		headers[i] = strings.ToLower(strings.ReplaceAll(h, " ", "_"))
+	}
+	w.Write(headers)
+	for _, r := range rows {
+		w.Write(r.record())
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// onuImportCommand runs `onu import [-dry-run] [-batch n] [-results file] <rollout.csv>`
+func onuImportCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("onu import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Only validate the rows and show what each would change")
+	batch := fs.Int("batch", 16, "Rows to provision before re-reading the registry to confirm them")
+	results := fs.String("results", "", "Results CSV (default: <rollout>-results.csv)")
+	fs.Usage = func() {
+		fmt.Println("onu import [-dry-run] [-batch n] [-results file] <rollout.csv>")
+		fs.PrintDefaults()
+		fmt.Printf("Columns: %s, Services are separated by ; | or spaces and a PON port of 0/x/y picks the ONU interface\n", strings.Join(OnuImportHeaders, ", "))
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *batch < 1 {
+		fs.Usage()
+		return gopon.ErrNotInput
+	}
+	path := fs.Arg(0)
+	rows, err := readOnuImport(path)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("%s: %v", path, gopon.ErrNotInput)
+	}
+	err = olt.UpdateOnuRegistry()
+	if err != nil {
+		return err
+	}
+	t, err := getProfileTables(olt)
+	if err != nil {
+		return err
+	}
+	planOnuImport(olt, t, rows)
+	var planned, failed int
+	var table [][]string
+	for _, r := range rows {
+		table = append(table, r.record())
+		if r.Result == "planned" {
+			planned++
+		} else {
+			failed++
+		}
+	}
+	tabwriteTable(fmt.Sprintf("Rollout %s", path), OnuImportResultHeaders, table)
+	fmt.Printf("++ %d rows pass the checks, %d do not\n", planned, failed)
+	if *dryRun {
+		return nil
+	}
+	runOnuImport(olt, rows, *batch)
+	if *results == "" {
+		*results = strings.TrimSuffix(path, ".csv") + "-results.csv"
+	}
+	err = writeOnuImportResults(*results, rows)
+	if err != nil {
+		return err
+	}
+	var ok int
+	for _, r := range rows {
+		if r.Result == "ok" {
+			ok++
+		}
+	}
+	fmt.Printf("++ %d of %d rows provisioned, results written to %s\n", ok, len(rows), *results)
+	return nil
+}
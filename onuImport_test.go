@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadOnuImport(t *testing.T) {
+	data := `Serial,PON Port,Services,Subscriber ID
+# comment lines are skipped
+1a2b3c4d, 3, hsi;voice, sub-1
+ISKT00000002,0/4/7,hsi|iptv voice,
+iskt00000003,0/5
+`
+	path := filepath.Join(t.TempDir(), "rollout.csv")
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := readOnuImport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []onuImportRow{
+		{Row: 1, SerialNumber: "ISKT1A2B3C4D", Port: "3", Services: []string{"hsi", "voice"}, Subscriber: "sub-1"},
+		{Row: 2, SerialNumber: "ISKT00000002", Port: "0/4/7", Services: []string{"hsi", "iptv", "voice"}},
+		{Row: 3, SerialNumber: "ISKT00000003", Port: "0/5", Services: []string{}},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("%d rows, want %d", len(rows), len(want))
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(*rows[i], w) {
+			t.Errorf("row %d is %+v, want %+v", i+1, *rows[i], w)
+		}
+	}
+}
+
+func TestReadOnuImportErrors(t *testing.T) {
+	dir := t.TempDir()
+	quote := filepath.Join(dir, "quote.csv")
+	err := ioutil.WriteFile(quote, []byte("ISKT00000001,\"0/1,hsi\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(dir, "missing.csv"), quote} {
+		if _, err := readOnuImport(path); err == nil {
+			t.Errorf("%s: no error", filepath.Base(path))
+		}
+	}
+}
+
+func TestOnuImportPort(t *testing.T) {
+	tests := []struct {
+		port    string
+		pon     string
+		intf    string
+		wantErr bool
+	}{
+		{"3", "0/3", "", false},
+		{"0/3", "0/3", "", false},
+		{"0/3/1", "0/3", "0/3/1", false},
+		{"0/3/128", "0/3", "0/3/128", false},
+		{"0/3/0", "", "", true},
+		{"0/3/129", "", "", true},
+		{"1/3", "", "", true},
+		{"0/3/1/2", "", "", true},
+		{"x", "", "", true},
+		{"0/-1", "", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		pon, intf, err := onuImportPort(tt.port)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: err = %v, want error %v", tt.port, err, tt.wantErr)
+			continue
+		}
+		if pon != tt.pon || intf != tt.intf {
+			t.Errorf("%q: got %q %q, want %q %q", tt.port, pon, intf, tt.pon, tt.intf)
+		}
+	}
+}
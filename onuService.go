@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+var errOnuServiceCheck = errors.New("the Service Profiles of the ONU do not pass the checks, nothing was changed")
+
+// validateOnuServices checks the Service Profiles planned for an ONU resolve and do not collide on T-CONT ID or Virtual GEM Port
+func validateOnuServices(t *profileTables, onu *gopon.OnuRegister, services []string) []string {
+	planned := *onu
+	planned.Services = services
+	var problems []string
+	seen := make(map[string]bool)
+	for _, s := range services {
+		if seen[s] {
+			problems = append(problems, fmt.Sprintf("Service Profile %s is given twice", s))
+		}
+		seen[s] = true
+	}
+	return append(problems, onuWarnings(getOnuConfig(t, &planned))...)
+}
+
+// plannedOnuServices applies an add, remove or swap to the services of the ONU
+func plannedOnuServices(current []string, op string, names []string) ([]string, error) {
+	has := func(name string) bool {
+		return containsString(current, name)
+	}
+	without := func(list []string, name string) []string {
+		var out []string
+		for _, s := range list {
+			if s != name {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	planned := append([]string(nil), current...)
+	switch op {
+	case "add":
+		for _, n := range names {
+			if has(n) {
+				return nil, fmt.Errorf("Service Profile %s: %v", n, gopon.ErrExists)
+			}
+			planned = append(planned, n)
+		}
+	case "remove":
+		for _, n := range names {
+			if !has(n) {
+				return nil, fmt.Errorf("Service Profile %s: %v", n, gopon.ErrNotExists)
+			}
+			planned = without(planned, n)
+		}
+	case "swap":
+		if len(names) != 2 {
+			return nil, fmt.Errorf("swap takes the Service Profile to remove and the one to add in its place")
+		}
+		if !has(names[0]) {
+			return nil, fmt.Errorf("Service Profile %s: %v", names[0], gopon.ErrNotExists)
+		}
+		if has(names[1]) {
+			return nil, fmt.Errorf("Service Profile %s: %v", names[1], gopon.ErrExists)
+		}
+		planned = append(without(planned, names[0]), names[1])
+	default:
+		return nil, fmt.Errorf("unknown onu service operation %s, one of: add, remove, swap", op)
+	}
+	return planned, nil
+}
+
+// sameServices compares two lists of Service Profiles regardless of order
+func sameServices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// applyOnuServices removes and adds Service Profiles until the ONU has the planned ones, removing first so a swap
+// does not collide with the profile it replaces, and if an add fails rolls the ONU back to the Service Profiles it had
+func applyOnuServices(olt *gopon.LumiaOlt, onu *gopon.OnuRegister, planned []string) error {
+	var removed, added []string
+	for _, s := range onu.Services {
+		if containsString(planned, s) {
+			continue
+		}
+		err := olt.RemoveOnuProfileUsage(onu.Interface, s)
+		if err != nil {
+			rollbackOnuServices(olt, onu, added, removed)
+			return fmt.Errorf("removing %s: %v", s, err)
+		}
+		fmt.Printf("++ Removed %s from %s\n", s, onu.Interface)
+		removed = append(removed, s)
+	}
+	for _, s := range planned {
+		if containsString(onu.Services, s) {
+			continue
+		}
+		err := olt.AddServiceToOnu(onu, s)
+		if err != nil {
+			rollbackOnuServices(olt, onu, added, removed)
+			return fmt.Errorf("adding %s: %v", s, err)
+		}
+		fmt.Printf("++ Added %s to %s\n", s, onu.Interface)
+		added = append(added, s)
+	}
+	return nil
+}
+
+// rollbackOnuServices takes the added Service Profiles off the ONU before restoring the removed ones,
+// so the ONU is left as it was and a restored profile does not collide with its replacement
+func rollbackOnuServices(olt *gopon.LumiaOlt, onu *gopon.OnuRegister, added, removed []string) {
+	for i := len(added) - 1; i >= 0; i-- {
+		err := olt.RemoveOnuProfileUsage(onu.Interface, added[i])
+		if err != nil {
+			fmt.Printf("!! Could not take %s back off %s: %v\n", added[i], onu.Interface, err)
+			continue
+		}
+		fmt.Printf("++ Took %s back off %s\n", added[i], onu.Interface)
+	}
+	for _, r := range removed {
+		err := olt.AddServiceToOnu(onu, r)
+		if err != nil {
+			fmt.Printf("!! Could not restore %s on %s: %v\n", r, onu.Interface, err)
+			continue
+		}
+		fmt.Printf("++ Restored %s on %s\n", r, onu.Interface)
+	}
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// onuServiceCommand runs `onu service add|remove|swap <serial|slot/port/onu> <service...>`
+func onuServiceCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("onu service", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Only show the checks and the Service Profiles the ONU would have")
+	fs.Usage = func() {
+		fmt.Println("onu service [-dry-run] add|remove <serial|slot/port/onu> <service...>")
+		fmt.Println("onu service [-dry-run] swap <serial|slot/port/onu> <old_service> <new_service>")
+		fs.PrintDefaults()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() < 3 {
+		fs.Usage()
+		return gopon.ErrNotInput
+	}
+	op := strings.ToLower(fs.Arg(0))
+	onu, err := findOnu(olt, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	planned, err := plannedOnuServices(onu.Services, op, fs.Args()[2:])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("++ ONU %s at %s: %s => %s\n", onu.SerialNumber, onu.Interface, serviceListString(onu.Services), serviceListString(planned))
+	t, err := getProfileTables(olt)
+	if err != nil {
+		return err
+	}
+	problems := validateOnuServices(t, onu, planned)
+	for _, p := range problems {
+		fmt.Printf("!! %s\n", p)
+	}
+	if len(problems) > 0 {
+		return errOnuServiceCheck
+	}
+	fmt.Println("++ T-CONT IDs, Virtual GEM Ports and sub-profiles check out")
+	if *dryRun {
+		return nil
+	}
+	err = applyOnuServices(olt, onu, planned)
+	if err != nil {
+		return err
+	}
+	// the registry read back is what the OLT applied
+	after, err := findOnu(olt, onu.SerialNumber)
+	if err != nil {
+		return err
+	}
+	if !sameServices(after.Services, planned) {
+		return fmt.Errorf("the OLT reports %s on %s, expected %s", serviceListString(after.Services), after.Interface, serviceListString(planned))
+	}
+	fmt.Printf("++ Confirmed from the registry: %s has %s\n", after.Interface, serviceListString(after.Services))
+	return nil
+}
+
+func serviceListString(list []string) string {
+	if len(list) == 0 {
+		return "no services"
+	}
+	return strings.Join(list, ", ")
+}
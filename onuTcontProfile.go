@@ -15,7 +15,11 @@ func displayOnuTcontProfiles(olt *gopon.LumiaOlt) error {
 	if err != nil {
 		return err
 	}
-	otpl.Tabwrite()
+	l := newProfileListing("onutcont", "ONU T-CONT Profile List", gopon.OnuTcontProfileHeaders)
+	for _, otp := range otpl.Entry {
+		l.addParams(otp.Name, otp.Usage, otp.ListEssentialParams())
+	}
+	tabwriteListing(l)
 	return nil
 }
 
@@ -35,6 +39,7 @@ func modifyOnuTcontProfiles(olt *gopon.LumiaOlt, arg string) error {
 	if err != nil {
 		return err
 	}
+	origName := otp.Name
 	fmt.Print(">> Would you like to delete this profile? (y/N)\n>> ")
 	input := strings.ToLower(sanitizeInput(readFromStdin()))
 	if input == "y" {
@@ -78,6 +83,17 @@ func modifyOnuTcontProfiles(olt *gopon.LumiaOlt, arg string) error {
 	fmt.Print(">> Post this modification? (Y/n)\n>> ")
 	postBool := strings.ToLower(sanitizeInput(readFromStdin()))
 	if postBool == "y" || postBool == "" {
+		err = checkTcontCollisions(olt, origName, otp)
+		if err != nil {
+			return err
+		}
+		ok, err := checkTcontBudget(olt, origName, otp)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
 		err = olt.DeleteOnuTcontProfile(otp.Name)
 		if err != nil {
 			// if the profile has been renamed it can't be deleted and this not 200 OK is expected
@@ -1,29 +1,131 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/lindsaybb/gopon"
 )
 
-// data structure not made available yet, placeholder
+// rules are a separate table on the OLT, keyed by profile name and rule id
+const onuVlanRuleTable = "msanOnuVlanProfileRuleTable"
+
+// the OLT answers a successful restconf request with this status
+const responseOk = "200 OK"
+
+// OnuVlanProfileMergedHeaders shows each profile followed by the rules it contains
+var OnuVlanProfileMergedHeaders = []string{
+	"Name",
+	"DsMode",
+	"TPID-In",
+	"TPID-Out",
+	"Rule",
+	"Match Criteria",
+	"Treatment",
+}
+
+// OnuVlanRuleOperations are the actions available on the Rules of an ONU VLAN Profile
+var OnuVlanRuleOperations = []string{
+	"Add Rule",
+	"Remove Rule",
+	"Reorder Rule",
+	"Match Criteria",
+	"Treatment",
+}
+
+// onuVlanProfileEntry is the profile table entry, the gopon GenerateJson also serializes the nested Rules
+type onuVlanProfileEntry struct {
+	Name           string `json:"msanOnuVlanProfileName"`
+	DownstreamMode int    `json:"msanOnuVlanProfileDownstreamMode"`
+	InputTPID      int    `json:"msanOnuVlanProfileInputTPID"`
+	OutputTPID     int    `json:"msanOnuVlanProfileOutputTPID"`
+}
 
 func displayOnuVlanProfiles(olt *gopon.LumiaOlt) error {
 	var err error
 	var ovpl *gopon.OnuVlanProfileList
-	var ovrl *gopon.OnuVlanRuleList
-	ovpl, ovrl, err = olt.GetOnuVlanProfiles()
-	// need to merge this table with the rules subset and sort accordingly
-	// use this display function call to complete implementation of gopon library
+	ovpl, _, err = olt.GetOnuVlanProfiles()
 	if err != nil {
 		return err
 	}
-	ovpl.Tabwrite()
-	ovrl.Tabwrite()
+	tabwriteListing(onuVlanProfileListing("ONU VLAN Profile List", ovpl.Entry))
 	return nil
 }
 
+// tabwriteOnuVlanProfiles merges each profile with its rules, sorted by rule id
+func tabwriteOnuVlanProfiles(title string, list []*gopon.OnuVlanProfile) {
+	l := onuVlanProfileListing(title, list)
+	var rows [][]string
+	for _, e := range l.Entries {
+		rows = append(rows, e.Lines...)
+	}
+	tabwriteTable(title, l.Headers, rows)
+}
+
+// onuVlanProfileListing lists each profile on the lines of its rules
+func onuVlanProfileListing(title string, list []*gopon.OnuVlanProfile) *profileListing {
+	l := newProfileListing("onuvlan", title, OnuVlanProfileMergedHeaders)
+	l.Detail, l.DetailName = 4, "rules"
+	for _, ovp := range list {
+		var rows [][]string
+		profile := []string{ovp.Name, ovp.GetDsMode(), fmt.Sprintf("%d", ovp.InputTPID), fmt.Sprintf("%d", ovp.OutputTPID)}
+		rules := sortedOnuVlanRules(ovp)
+		if len(rules) == 0 {
+			rows = append(rows, append(profile, "", "", ""))
+		}
+		for i, r := range rules {
+			if i > 0 {
+				profile = []string{"", "", "", ""}
+			}
+			rows = append(rows, append(profile, fmt.Sprintf("%d", r.RuleID), r.GetMatchCriteriaString(), r.GetActionListString()))
+		}
+		l.add(ovp.Name, ovp.Usage, rows...)
+	}
+	return l
+}
+
+func sortedOnuVlanRules(ovp *gopon.OnuVlanProfile) []*gopon.OnuVlanRule {
+	if ovp.Rules == nil {
+		return nil
+	}
+	rules := append([]*gopon.OnuVlanRule{}, ovp.Rules.Entry...)
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].RuleID < rules[j].RuleID
+	})
+	return rules
+}
+
+// cloneOnuVlanProfile returns a deep copy that is not overwritten by the next request to the OLT
+func cloneOnuVlanProfile(ovp *gopon.OnuVlanProfile) *gopon.OnuVlanProfile {
+	np := *ovp
+	np.Rules = &gopon.OnuVlanRuleList{}
+	for _, r := range sortedOnuVlanRules(ovp) {
+		nr := *r
+		np.Rules.Entry = append(np.Rules.Entry, &nr)
+	}
+	return &np
+}
+
+// copyOnuVlanProfile renames the profile and its rules with Usage set to 2, like the gopon Copy methods
+func copyOnuVlanProfile(ovp *gopon.OnuVlanProfile, newName string) (*gopon.OnuVlanProfile, error) {
+	if newName == "" {
+		return nil, gopon.ErrNotInput
+	}
+	if ovp.Name == newName {
+		return nil, gopon.ErrExists
+	}
+	np := cloneOnuVlanProfile(ovp)
+	np.Name = newName
+	np.Usage = 2
+	for _, r := range np.Rules.Entry {
+		r.Name = newName
+	}
+	return np, nil
+}
+
 func modifyOnuVlanProfiles(olt *gopon.LumiaOlt) error {
 	profType := "ONU VLAN"
 	err := displayOnuVlanProfiles(olt)
@@ -54,6 +156,376 @@ func modifyOnuVlanProfiles(olt *gopon.LumiaOlt) error {
 			return olt.DeleteOnuVlanProfile(ovp.Name)
 		}
 	}
+	// the profile and rules point into tables that are overwritten by the delete and post requests
+	ovp = cloneOnuVlanProfile(ovp)
+	// rules already on the OLT under this name are removed before the edited set is posted
+	origName := ovp.Name
+	var origRules []int
+	for _, r := range ovp.Rules.Entry {
+		origRules = append(origRules, r.RuleID)
+	}
+	if ovp.IsUsed() {
+		fmt.Println("!! Cannot modify in-use profile")
+		ovp, err = modifyOnuVlanProfileHandler(olt, ovp, 0)
+		if err != nil {
+			return err
+		}
+	}
+	arg := getArgFromSelection(gopon.OnuVlanProfileHeaders)
+	for {
+		modVal := getIntFromArg(arg, gopon.OnuVlanProfileHeaders)
+		ovp, err = modifyOnuVlanProfileHandler(olt, ovp, modVal)
+		if err != nil {
+			return err
+		}
+		fmt.Printf(">> Modified %s Profile:\n", profType)
+		tabwriteOnuVlanProfiles("ONU VLAN Profile", []*gopon.OnuVlanProfile{ovp})
+		fmt.Print(">> Make further modifications? (y/N)\n>> ")
+		modBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if modBool == "y" {
+			arg = getArgFromSelection(gopon.OnuVlanProfileHeaders)
+		} else {
+			break
+		}
+	}
+	fmt.Print(">> Post this modification? (Y/n)\n>> ")
+	postBool := strings.ToLower(sanitizeInput(readFromStdin()))
+	if postBool == "y" || postBool == "" {
+		if ovp.Name == origName {
+			err = deleteOnuVlanProfileWithRules(olt, origName, origRules)
+			if err != nil {
+				return err
+			}
+		}
+		return postOnuVlanProfileWithRules(olt, ovp)
+	}
+	return nil
+}
+
+// deleteOnuVlanProfileWithRules removes the listed rules and then the profile itself
+func deleteOnuVlanProfileWithRules(olt *gopon.LumiaOlt, name string, rules []int) error {
+	for _, id := range rules {
+		resp, err := gopon.RestDeleteProfile(olt.Host, onuVlanRuleTable, fmt.Sprintf("%s,%d", name, id))
+		if err != nil {
+			return err
+		}
+		if resp != responseOk {
+			// the rules may already have been removed together with the profile
+			fmt.Printf("!! Rule %d: %s\n", id, resp)
+		}
+	}
+	err := olt.DeleteOnuVlanProfile(name)
+	if err != nil && err != gopon.ErrNotExists {
+		return err
+	}
+	return nil
+}
+
+// postOnuVlanProfileWithRules posts the profile table entry followed by each of its rules
+func postOnuVlanProfileWithRules(olt *gopon.LumiaOlt, ovp *gopon.OnuVlanProfile) error {
+	data, err := json.Marshal(&onuVlanProfileEntry{
+		Name:           ovp.Name,
+		DownstreamMode: ovp.DownstreamMode,
+		InputTPID:      ovp.InputTPID,
+		OutputTPID:     ovp.OutputTPID,
+	})
+	if err != nil {
+		return err
+	}
+	err = olt.PostOnuVlanProfile(ovp.Name, data)
+	if err != nil {
+		return err
+	}
+	for _, r := range sortedOnuVlanRules(ovp) {
+		data, err = json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		resp, err := gopon.RestPostProfile(olt.Host, onuVlanRuleTable, fmt.Sprintf("%s,%d", r.Name, r.RuleID), data)
+		if err != nil {
+			return err
+		}
+		if resp != responseOk {
+			fmt.Printf("!! Rule %d: %s\n", r.RuleID, resp)
+			return gopon.ErrNotStatusOk
+		}
+	}
+	return nil
+}
+
+func modifyOnuVlanProfileHandler(olt *gopon.LumiaOlt, ovp *gopon.OnuVlanProfile, modVal int) (*gopon.OnuVlanProfile, error) {
+	var err error
+	switch modVal {
+	case 0:
+		// Name
+		fmt.Print(">> Provide new name for ONU VLAN Profile\n>> ")
+		newOvpName := sanitizeInput(readFromStdin())
+		ovp, err = copyOnuVlanProfile(ovp, newOvpName)
+		if err != nil {
+			return nil, err
+		}
+	case 1:
+		// DsMode
+		fmt.Println("++ Downstream Mode applies the inverse of the upstream rules to downstream frames (Enabled by default)")
+		fmt.Printf(">> Current value is [%v], toggle status? (Y/n)\n>> ", ovp.GetDsMode())
+		togBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if togBool == "y" || togBool == "" {
+			if ovp.DownstreamMode == 1 {
+				ovp.DownstreamMode = 2
+			} else {
+				ovp.DownstreamMode = 1
+			}
+		}
+	case 2:
+		// TPID-In
+		fmt.Println("++ Input TPID value (decimal) used by rules that match on it. Default value is 33024: 0x8100")
+		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", ovp.InputTPID)
+		newInt := sanitizeInput(readFromStdin())
+		if newInt != "" {
+			i, err := strconv.Atoi(newInt)
+			if err != nil {
+				return nil, gopon.ErrNotInput
+			}
+			if i >= 2048 && i < 65536 {
+				ovp.InputTPID = i
+			} else {
+				ovp.InputTPID = 33024
+			}
+		}
+	case 3:
+		// TPID-Out
+		fmt.Println("++ Output TPID value (decimal) used by rules that add tags with it. Default value is 34984: 0x88a8")
+		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", ovp.OutputTPID)
+		newInt := sanitizeInput(readFromStdin())
+		if newInt != "" {
+			i, err := strconv.Atoi(newInt)
+			if err != nil {
+				return nil, gopon.ErrNotInput
+			}
+			if i >= 2048 && i < 65536 {
+				ovp.OutputTPID = i
+			} else {
+				ovp.OutputTPID = 34984
+			}
+		}
+	case 4:
+		// Rules
+		fmt.Printf(">> Current Rules are: [%v]\n", ovp.GetRulesString())
+		arg := getArgFromSelection(OnuVlanRuleOperations)
+		modVal := getIntFromArg(arg, OnuVlanRuleOperations)
+		ovp, err = modifyOnuVlanRules(ovp, modVal)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		fmt.Println("!! Unpexpected input, nothing to modify")
+	}
+	return ovp, nil
+}
 
+// getOnuVlanRuleFromInput prompts for the id of an existing rule
+func getOnuVlanRuleFromInput(ovp *gopon.OnuVlanProfile) (*gopon.OnuVlanRule, error) {
+	fmt.Printf(">> Which Rule? [%v]\n>> ", ovp.GetRulesString())
+	id, err := strconv.Atoi(sanitizeInput(readFromStdin()))
+	if err != nil {
+		return nil, gopon.ErrNotInput
+	}
+	return ovp.GetRuleById(id)
+}
+
+// getIntListFromInput reads a space-separated list of exactly n values
+func getIntListFromInput(n int) ([]int, error) {
+	fields := strings.Fields(readFromStdin())
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	if len(fields) != n {
+		return nil, gopon.ErrNotInput
+	}
+	var list []int
+	for _, f := range fields {
+		i, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, gopon.ErrNotInput
+		}
+		list = append(list, i)
+	}
+	return list, nil
+}
+
+func modifyOnuVlanRules(ovp *gopon.OnuVlanProfile, modVal int) (*gopon.OnuVlanProfile, error) {
+	switch modVal {
+	case 0:
+		// Add Rule
+		fmt.Println("++ Rules are evaluated in order of Rule ID. IDs 97, 98 and 99 are the default rules for untagged, single-tagged and double-tagged frames")
+		fmt.Print(">> Provide the ID of the new Rule (1...99):\n>> ")
+		id, err := strconv.Atoi(sanitizeInput(readFromStdin()))
+		if err != nil || id < 1 || id > 99 {
+			return nil, gopon.ErrNotInput
+		}
+		if _, err = ovp.GetRuleById(id); err == nil {
+			return nil, gopon.ErrExists
+		}
+		r := &gopon.OnuVlanRule{Name: ovp.Name, RuleID: id}
+		// start from the single-tagged default rule and the default treatment
+		var match, actions []int
+		for _, v := range gopon.OnuVlanRuleMatchCriteria {
+			match = append(match, gopon.DefRule98MatchCriteria[v])
+		}
+		for _, v := range gopon.OnuVlanRuleActionList {
+			actions = append(actions, gopon.DefaultActionList[v])
+		}
+		r.SetMatchCriteria(match)
+		r.SetActions(actions)
+		fmt.Printf(">> Provide the Match Criteria as a space-separated list (%s), or leave empty to match single-tagged frames:\n>> ", strings.Join(gopon.OnuVlanRuleMatchCriteria, " "))
+		list, err := getIntListFromInput(len(gopon.OnuVlanRuleMatchCriteria))
+		if err != nil {
+			return nil, err
+		}
+		if list != nil {
+			if err = validateOnuVlanRuleValues(list, onuVlanRuleMatchRanges); err != nil {
+				return nil, err
+			}
+			r.SetMatchCriteria(list)
+		}
+		fmt.Printf(">> Provide the Treatment as a space-separated list (%s), or leave empty for the default treatment:\n>> ", strings.Join(gopon.OnuVlanRuleActionList, " "))
+		list, err = getIntListFromInput(len(gopon.OnuVlanRuleActionList))
+		if err != nil {
+			return nil, err
+		}
+		if list != nil {
+			if err = validateOnuVlanRuleValues(list, onuVlanRuleActionRanges); err != nil {
+				return nil, err
+			}
+			r.SetActions(list)
+		}
+		ovp.Rules.Entry = append(ovp.Rules.Entry, r)
+	case 1:
+		// Remove Rule
+		r, err := getOnuVlanRuleFromInput(ovp)
+		if err != nil {
+			return nil, err
+		}
+		var rules []*gopon.OnuVlanRule
+		for _, v := range ovp.Rules.Entry {
+			if v != r {
+				rules = append(rules, v)
+			}
+		}
+		ovp.Rules.Entry = rules
+	case 2:
+		// Reorder Rule
+		fmt.Println("++ Rules are evaluated in order of Rule ID, moving a Rule to an ID that is in use swaps the two Rules")
+		r, err := getOnuVlanRuleFromInput(ovp)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf(">> Rule %d: provide the new ID (1...99):\n>> ", r.RuleID)
+		id, err := strconv.Atoi(sanitizeInput(readFromStdin()))
+		if err != nil || id < 1 || id > 99 {
+			return nil, gopon.ErrNotInput
+		}
+		if other, err := ovp.GetRuleById(id); err == nil {
+			other.RuleID = r.RuleID
+		}
+		r.RuleID = id
+	case 3:
+		// Match Criteria
+		r, err := getOnuVlanRuleFromInput(ovp)
+		if err != nil {
+			return nil, err
+		}
+		list := r.GetMatchCriteria()
+		fmt.Printf(">> Current Match Criteria are: [%v]\n", r.GetMatchCriteriaString())
+		arg := getArgFromSelection(gopon.OnuVlanRuleMatchCriteria)
+		i := getIntFromArg(arg, gopon.OnuVlanRuleMatchCriteria)
+		if i < 0 {
+			return ovp, nil
+		}
+		list[i], err = getOnuVlanRuleValue(gopon.OnuVlanRuleMatchCriteria[i], list[i], onuVlanRuleMatchRanges[i])
+		if err != nil {
+			return nil, err
+		}
+		r.SetMatchCriteria(list)
+	case 4:
+		// Treatment
+		r, err := getOnuVlanRuleFromInput(ovp)
+		if err != nil {
+			return nil, err
+		}
+		list := r.GetActionList()
+		fmt.Printf(">> Current Treatment is: [%v]\n", r.GetActionListString())
+		arg := getArgFromSelection(gopon.OnuVlanRuleActionList)
+		i := getIntFromArg(arg, gopon.OnuVlanRuleActionList)
+		if i < 0 {
+			return ovp, nil
+		}
+		list[i], err = getOnuVlanRuleValue(gopon.OnuVlanRuleActionList[i], list[i], onuVlanRuleActionRanges[i])
+		if err != nil {
+			return nil, err
+		}
+		r.SetActions(list)
+	default:
+		fmt.Println("!! Unpexpected input, nothing to modify")
+	}
+	return ovp, nil
+}
+
+// onuVlanRuleRange describes the settable values of a single rule field
+type onuVlanRuleRange struct {
+	Min  int
+	Max  int
+	Help string
+}
+
+// in the order of gopon.OnuVlanRuleMatchCriteria
+var onuVlanRuleMatchRanges = []onuVlanRuleRange{
+	{-1, 4096, "Match S-VID (0...4095), where 4096 matches frames without an S-Tag and -1 matches any S-VID"},
+	{-1, 7, "Match S-PCP (0...7), where -1 matches any S-PCP"},
+	{0, 7, "Match S-TPID/DEI filter (0...7), where 0 does not filter"},
+	{-1, 4096, "Match C-VID (0...4095), where 4096 matches frames without a C-Tag and -1 matches any C-VID"},
+	{-1, 7, "Match C-PCP (0...7), where -1 matches any C-PCP"},
+	{0, 7, "Match C-TPID/DEI filter (0...7), where 0 does not filter"},
+	{0, 4, "Match Ethertype filter (0: none, 1: IPoE, 2: PPPoE, 3: ARP, 4: IPv6 IPoE)"},
+}
+
+// in the order of gopon.OnuVlanRuleActionList
+var onuVlanRuleActionRanges = []onuVlanRuleRange{
+	{1, 4, "Tags to remove (1: none, 2: one, 3: two, 4: discard the frame)"},
+	{1, 2, "Add an S-Tag (1: add, 2: do not add)"},
+	{0, 7, "S-PCP of the added S-Tag (0...7)"},
+	{0, 4096, "S-VID of the added S-Tag (0...4095), where 4096 copies the VID of the received tag"},
+	{0, 7, "S-TPID/DEI of the added S-Tag (0...7)"},
+	{1, 2, "Add a C-Tag (1: add, 2: do not add)"},
+	{0, 7, "C-PCP of the added C-Tag (0...7)"},
+	{0, 4096, "C-VID of the added C-Tag (0...4095), where 4096 copies the VID of the received tag"},
+	{0, 7, "C-TPID/DEI of the added C-Tag (0...7)"},
+}
+
+func validateOnuVlanRuleValues(list []int, ranges []onuVlanRuleRange) error {
+	for i, v := range list {
+		if v < ranges[i].Min || v > ranges[i].Max {
+			fmt.Printf("!! Value %d out of range: %s\n", v, ranges[i].Help)
+			return gopon.ErrNotInput
+		}
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+func getOnuVlanRuleValue(name string, current int, rng onuVlanRuleRange) (int, error) {
+	fmt.Printf("++ %s\n", rng.Help)
+	fmt.Printf(">> %s: current value is [%v], provide new value:\n>> ", name, current)
+	newInt := sanitizeInput(readFromStdin())
+	if newInt == "" {
+		return current, nil
+	}
+	i, err := strconv.Atoi(newInt)
+	if err != nil {
+		return current, gopon.ErrNotInput
+	}
+	if i < rng.Min || i > rng.Max {
+		fmt.Println("!! Not settable")
+		return current, nil
+	}
+	return i, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+// OutputFormats are the values of -output, text is the tab-aligned tables
+var OutputFormats = []string{
+	"text",
+	"json",
+	"yaml",
+	"csv",
+	"markdown",
+}
+
+// outputTable is the schema of a table in json and yaml: the columns become snake_case keys with string values,
+// a profile listing adds its type, in_use and, for ONU VLAN Profiles, the rules nested under the profile
+type outputTable struct {
+	Olt   string                   `json:"olt,omitempty" yaml:"olt,omitempty"`
+	Type  string                   `json:"type,omitempty" yaml:"type,omitempty"`
+	Title string                   `json:"title" yaml:"title"`
+	Rows  []map[string]interface{} `json:"rows" yaml:"rows"`
+	// headers and lines are the table as shown, for csv and markdown
+	headers []string
+	lines   [][]string
+}
+
+var (
+	// outputDoc receives the tables, everything else is written to stderr when the format is not text
+	outputDoc     io.Writer = os.Stdout
+	outputTables  []*outputTable
+	outputWritten bool
+	// fleetRun is set when a command runs on several OLTs, each table then names its OLT
+	fleetRun bool
+)
+
+// useOutputFormat checks the format and, for anything but text, moves the prompts and notes off stdout
+func useOutputFormat(format string) error {
+	format = strings.ToLower(format)
+	found := false
+	for _, f := range OutputFormats {
+		if f == format {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown output format %s, one of: %s", format, strings.Join(OutputFormats, ", "))
+	}
+	listOpts.Output = format
+	if format != "text" && os.Stdout != os.Stderr {
+		outputDoc = os.Stdout
+		os.Stdout = os.Stderr
+	}
+	return nil
+}
+
+// reportWriter returns the writer for a report in a format of its own, moving the prompts and the requests
+// gopon prints off stdout in the same way as useOutputFormat
+func reportWriter() io.Writer {
+	if os.Stdout != os.Stderr {
+		outputDoc = os.Stdout
+		os.Stdout = os.Stderr
+	}
+	return outputDoc
+}
+
+// fieldKey turns a column header into the key of the schema, "Max Rate" and "MaxRate" are both max_rate
+func fieldKey(h string) string {
+	var b strings.Builder
+	lower := false
+	sep := false
+	for _, r := range h {
+		switch {
+		case unicode.IsUpper(r):
+			if lower || (sep && b.Len() > 0) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			lower, sep = false, false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if sep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			lower, sep = true, false
+		default:
+			sep = true
+		}
+	}
+	return b.String()
+}
+
+// rowObject keys the cells of a line by column, every cell is the string shown in the table so a column keeps
+// one type whatever the values it holds
+func rowObject(headers, line []string) map[string]interface{} {
+	m := make(map[string]interface{}, len(headers))
+	for i, h := range headers {
+		if i < len(line) {
+			m[fieldKey(h)] = line[i]
+		}
+	}
+	return m
+}
+
+// writeTable emits a table in the output format, json and yaml are held for one document written by flushOutput
+func writeTable(t *outputTable) {
+	if fleetRun {
+		t.Olt = activeOlt.Name
+	}
+	switch listOpts.Output {
+	case "json", "yaml":
+		outputTables = append(outputTables, t)
+	case "csv":
+		if outputWritten {
+			fmt.Fprintln(outputDoc)
+		}
+		w := csv.NewWriter(outputDoc)
+		var keys []string
+		if t.Olt != "" {
+			keys = append(keys, "olt")
+		}
+		for _, h := range t.headers {
+			keys = append(keys, fieldKey(h))
+		}
+		w.Write(keys)
+		for _, line := range t.lines {
+			if t.Olt != "" {
+				line = append([]string{t.Olt}, line...)
+			}
+			w.Write(line)
+		}
+		w.Flush()
+		outputWritten = true
+	case "markdown":
+		if outputWritten {
+			fmt.Fprintln(outputDoc)
+		}
+		if t.Olt != "" {
+			fmt.Fprintf(outputDoc, "### %s: %s\n\n", t.Olt, t.Title)
+		} else {
+			fmt.Fprintf(outputDoc, "### %s\n\n", t.Title)
+		}
+		fmt.Fprintf(outputDoc, "| %s |\n", strings.Join(t.headers, " | "))
+		fmt.Fprintf(outputDoc, "|%s\n", strings.Repeat(" --- |", len(t.headers)))
+		for _, line := range t.lines {
+			cells := make([]string, len(line))
+			for i, c := range line {
+				cells[i] = strings.ReplaceAll(c, "|", "\\|")
+			}
+			fmt.Fprintf(outputDoc, "| %s |\n", strings.Join(cells, " | "))
+		}
+		outputWritten = true
+	}
+}
+
+// flushOutput writes the json or yaml document, an empty list when nothing was shown
+func flushOutput() error {
+	if listOpts.Output != "json" && listOpts.Output != "yaml" {
+		return nil
+	}
+	if outputWritten && len(outputTables) == 0 {
+		return nil
+	}
+	tables := outputTables
+	if tables == nil {
+		tables = []*outputTable{}
+	}
+	outputTables = nil
+	outputWritten = true
+	if listOpts.Output == "yaml" {
+		data, err := yaml.Marshal(tables)
+		if err != nil {
+			return err
+		}
+		_, err = outputDoc.Write(data)
+		return err
+	}
+	data, err := json.MarshalIndent(tables, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(outputDoc, string(data))
+	return err
+}
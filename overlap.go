@@ -0,0 +1,597 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// matchRelation is how the frames matched by one set of criteria relate to those of another
+type matchRelation int
+
+const (
+	relDisjoint matchRelation = iota
+	relEqual
+	relSubset
+	relSuperset
+	relOverlap
+)
+
+// combineRelations joins the relations of each criterion, the criteria are disjoint if any one of them is
+func combineRelations(list []matchRelation) matchRelation {
+	r := relEqual
+	for _, x := range list {
+		switch {
+		case x == relDisjoint:
+			return relDisjoint
+		case x == relEqual:
+		case r == relEqual:
+			r = x
+		case r != x:
+			r = relOverlap
+		}
+	}
+	return r
+}
+
+// valueSet is the values a criterion accepts, -1 standing for a field the frame does not have
+type valueSet struct {
+	All    bool
+	Values []int
+}
+
+func allValues() valueSet {
+	return valueSet{All: true}
+}
+
+func someValues(list ...int) valueSet {
+	s := valueSet{}
+	for _, v := range list {
+		if !containsInt(s.Values, v) {
+			s.Values = append(s.Values, v)
+		}
+	}
+	sort.Ints(s.Values)
+	return s
+}
+
+// rangeValues returns the values within min...max the function keeps
+func rangeValues(min, max int, keep func(int) bool) valueSet {
+	s := valueSet{}
+	for v := min; v <= max; v++ {
+		if keep(v) {
+			s.Values = append(s.Values, v)
+		}
+	}
+	return s
+}
+
+func (s valueSet) empty() bool {
+	return !s.All && len(s.Values) == 0
+}
+
+func (s valueSet) intersect(o valueSet) valueSet {
+	if s.All {
+		return o
+	}
+	if o.All {
+		return s
+	}
+	out := valueSet{}
+	for _, v := range s.Values {
+		if containsInt(o.Values, v) {
+			out.Values = append(out.Values, v)
+		}
+	}
+	return out
+}
+
+func (s valueSet) relation(o valueSet) matchRelation {
+	switch {
+	case s.empty() || o.empty():
+		return relDisjoint
+	case s.All && o.All:
+		return relEqual
+	case s.All:
+		return relSuperset
+	case o.All:
+		return relSubset
+	}
+	n := len(s.intersect(o).Values)
+	switch {
+	case n == 0:
+		return relDisjoint
+	case n == len(s.Values) && n == len(o.Values):
+		return relEqual
+	case n == len(s.Values):
+		return relSubset
+	case n == len(o.Values):
+		return relSuperset
+	}
+	return relOverlap
+}
+
+// maskedAddr is a MAC or IP address criterion, nil when every address matches
+type maskedAddr struct {
+	Addr []byte
+	Mask []byte
+}
+
+func newMaskedMac(addr, mask string) (*maskedAddr, error) {
+	a, err := net.ParseMAC(addr)
+	if err != nil {
+		return nil, err
+	}
+	m := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if mask != "" {
+		m, err = net.ParseMAC(mask)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(m) != len(a) {
+		return nil, fmt.Errorf("invalid mask %s", mask)
+	}
+	return &maskedAddr{Addr: a, Mask: m}, nil
+}
+
+// newMaskedIP reads an IPv4 address under a dotted mask, or an IPv6 address under a prefix length, as ipMatches compares them
+func newMaskedIP(addr, mask string, prefixLen int) (*maskedAddr, error) {
+	a := net.ParseIP(addr)
+	if a == nil {
+		return nil, fmt.Errorf("invalid address %s", addr)
+	}
+	if a.To4() != nil {
+		m := net.IP(net.CIDRMask(32, 32))
+		if mask != "" {
+			m = net.ParseIP(mask)
+			if m == nil || m.To4() == nil {
+				return nil, fmt.Errorf("invalid mask %s", mask)
+			}
+		}
+		return &maskedAddr{Addr: a.To4(), Mask: m.To4()}, nil
+	}
+	m := net.CIDRMask(128, 128)
+	if prefixLen > 0 && prefixLen <= 128 {
+		m = net.CIDRMask(prefixLen, 128)
+	}
+	return &maskedAddr{Addr: a.To16(), Mask: m}, nil
+}
+
+func (a *maskedAddr) relation(b *maskedAddr) matchRelation {
+	switch {
+	case a == nil && b == nil:
+		return relEqual
+	case a == nil:
+		return relSuperset
+	case b == nil:
+		return relSubset
+	case len(a.Addr) != len(b.Addr):
+		return relDisjoint
+	}
+	// a is within b when b compares no bit a leaves open
+	aInB, bInA := true, true
+	for i := range a.Addr {
+		if (a.Addr[i]^b.Addr[i])&a.Mask[i]&b.Mask[i] != 0 {
+			return relDisjoint
+		}
+		if b.Mask[i]&^a.Mask[i] != 0 {
+			aInB = false
+		}
+		if a.Mask[i]&^b.Mask[i] != 0 {
+			bInA = false
+		}
+	}
+	switch {
+	case aInB && bInA:
+		return relEqual
+	case aInB:
+		return relSubset
+	case bInA:
+		return relSuperset
+	}
+	return relOverlap
+}
+
+// flowSpace is the frames a flowMatch accepts, with every criterion resolved to the values or addresses it lets through
+type flowSpace struct {
+	// Reason is set when no frame can match
+	Reason    string
+	CVlans    valueSet
+	SVlans    valueSet
+	CPcp      valueSet
+	SPcp      valueSet
+	Ethertype valueSet
+	Protocol  valueSet
+	Dscp      valueSet
+	SrcPort   valueSet
+	DstPort   valueSet
+	MacDst    *maskedAddr
+	MacSrc    *maskedAddr
+	IPSrc     *maskedAddr
+	IPDst     *maskedAddr
+}
+
+var FlowSpaceDimensions = []string{
+	"C-VLAN",
+	"S-VLAN",
+	"C-PCP",
+	"S-PCP",
+	"Ethertype",
+	"IP Protocol",
+	"DSCP",
+	"Source Port",
+	"Destination Port",
+}
+
+// values returns the value criteria in the order of FlowSpaceDimensions
+func (s *flowSpace) values() []*valueSet {
+	return []*valueSet{&s.CVlans, &s.SVlans, &s.CPcp, &s.SPcp, &s.Ethertype, &s.Protocol, &s.Dscp, &s.SrcPort, &s.DstPort}
+}
+
+func (s *flowSpace) addrs() []*maskedAddr {
+	return []*maskedAddr{s.MacDst, s.MacSrc, s.IPSrc, s.IPDst}
+}
+
+// newFlowSpace resolves the criteria the same way evaluate compares a frame to them
+func newFlowSpace(m *flowMatch, scope *flowVlanScope) *flowSpace {
+	s := &flowSpace{}
+	for _, v := range s.values() {
+		*v = allValues()
+	}
+	if m.Any {
+		return s
+	}
+	var defined bool
+	restrict := func(v *valueSet, o valueSet) {
+		*v = v.intersect(o)
+		defined = true
+	}
+	address := func(name string, a *maskedAddr, err error) *maskedAddr {
+		if err != nil && s.Reason == "" {
+			s.Reason = fmt.Sprintf("%s is invalid: %v", name, err)
+		}
+		defined = true
+		return a
+	}
+	ip := someValues(ethertypeIPv4, ethertypeIPv6)
+	if m.VlanProfile {
+		if scope == nil {
+			s.Reason = "it matches on the VLAN Profile, but the service has none"
+			return s
+		}
+		if len(scope.CVlans) > 0 {
+			restrict(&s.CVlans, someValues(scope.CVlans...))
+		}
+		// the S-VID is only compared on frames carrying an S-tag
+		if scope.SVlan > 0 {
+			restrict(&s.SVlans, someValues(-1, scope.SVlan))
+		}
+	}
+	if m.MacDst != "" {
+		a, err := newMaskedMac(m.MacDst, m.MacDstMask)
+		s.MacDst = address("MacDest", a, err)
+	}
+	if m.MacSrc != "" {
+		a, err := newMaskedMac(m.MacSrc, m.MacSrcMask)
+		s.MacSrc = address("MacSrc", a, err)
+	}
+	if m.CPcp >= 0 {
+		restrict(&s.CPcp, someValues(m.CPcp))
+	}
+	if m.SPcp >= 0 {
+		restrict(&s.SPcp, someValues(m.SPcp))
+	}
+	if len(m.CVlans) > 0 {
+		restrict(&s.CVlans, someValues(m.CVlans...))
+	}
+	if len(m.SVlans) > 0 {
+		restrict(&s.SVlans, someValues(m.SVlans...))
+	}
+	if m.Ethertype >= 0 {
+		restrict(&s.Ethertype, someValues(m.Ethertype))
+	}
+	if m.IPProtocol >= 0 {
+		restrict(&s.Protocol, someValues(m.IPProtocol))
+		restrict(&s.Ethertype, ip)
+	}
+	if m.IPSrc != "" {
+		a, err := newMaskedIP(m.IPSrc, m.IPSrcMask, 0)
+		s.IPSrc = address("IPSrc", a, err)
+		restrict(&s.Ethertype, someValues(ethertypeIPv4))
+	}
+	if m.IPDst != "" {
+		a, err := newMaskedIP(m.IPDst, m.IPDstMask, 0)
+		s.IPDst = address("IPDest", a, err)
+		restrict(&s.Ethertype, someValues(ethertypeIPv4))
+	}
+	if m.IPDscp >= 0 {
+		restrict(&s.Dscp, someValues(m.IPDscp))
+		restrict(&s.Ethertype, ip)
+	}
+	if m.IPCsc >= 0 {
+		restrict(&s.Dscp, rangeValues(0, 63, func(d int) bool { return d>>3 == m.IPCsc }))
+		restrict(&s.Ethertype, ip)
+	}
+	if m.IPDropPrecedence >= 0 {
+		restrict(&s.Dscp, rangeValues(0, 63, func(d int) bool { return (d>>1)&3 == m.IPDropPrecedence }))
+		restrict(&s.Ethertype, ip)
+	}
+	ports := []struct {
+		port, protocol int
+		set            *valueSet
+	}{
+		{m.TCPSrcPort, ipProtocolTcp, &s.SrcPort},
+		{m.TCPDstPort, ipProtocolTcp, &s.DstPort},
+		{m.UDPSrcPort, ipProtocolUdp, &s.SrcPort},
+		{m.UDPDstPort, ipProtocolUdp, &s.DstPort},
+	}
+	for _, p := range ports {
+		if p.port >= 0 {
+			restrict(p.set, someValues(p.port))
+			restrict(&s.Protocol, someValues(p.protocol))
+			restrict(&s.Ethertype, ip)
+		}
+	}
+	if m.IPv6Src != "" {
+		a, err := newMaskedIP(m.IPv6Src, "", m.IPv6SrcLen)
+		s.IPSrc = address("Ipv6SrcAddr", a, err)
+		restrict(&s.Ethertype, someValues(ethertypeIPv6))
+	}
+	if m.IPv6Dst != "" {
+		a, err := newMaskedIP(m.IPv6Dst, "", m.IPv6DstLen)
+		s.IPDst = address("Ipv6DstAddr", a, err)
+		restrict(&s.Ethertype, someValues(ethertypeIPv6))
+	}
+	if s.Reason != "" {
+		return s
+	}
+	if !defined {
+		s.Reason = "no match criteria are set"
+		return s
+	}
+	for i, v := range s.values() {
+		if v.empty() {
+			s.Reason = fmt.Sprintf("the %s criteria exclude each other", FlowSpaceDimensions[i])
+			break
+		}
+	}
+	return s
+}
+
+// relation compares the frames of two spaces, a space no frame matches is disjoint from every other
+func (s *flowSpace) relation(o *flowSpace) matchRelation {
+	if s.Reason != "" || o.Reason != "" {
+		return relDisjoint
+	}
+	var list []matchRelation
+	ov := o.values()
+	for i, v := range s.values() {
+		list = append(list, v.relation(*ov[i]))
+	}
+	oa := o.addrs()
+	for i, a := range s.addrs() {
+		list = append(list, a.relation(oa[i]))
+	}
+	return combineRelations(list)
+}
+
+// scopeVlans returns the S-VLANs and C-VLANs of a VLAN Profile, a missing profile, C-VID list or S-VID standing for every VLAN
+func scopeVlans(scope *flowVlanScope) (valueSet, valueSet) {
+	svlans, cvlans := allValues(), allValues()
+	if scope == nil {
+		return svlans, cvlans
+	}
+	if scope.SVlan > 0 {
+		svlans = someValues(scope.SVlan)
+	}
+	if len(scope.CVlans) > 0 {
+		cvlans = someValues(scope.CVlans...)
+	}
+	return svlans, cvlans
+}
+
+// sharedVlans returns the S-VLANs and C-VLANs the VLAN Profiles of two services have in common,
+// the services share no VLAN when either set is empty
+func sharedVlans(a, b *flowVlanScope) (valueSet, valueSet) {
+	as, ac := scopeVlans(a)
+	bs, bc := scopeVlans(b)
+	return as.intersect(bs), ac.intersect(bc)
+}
+
+// sharedVlanString describes the shared VLANs, a dimension left open by both profiles is not named
+func sharedVlanString(svlans, cvlans valueSet) string {
+	switch {
+	case svlans.All && cvlans.All:
+		return "every VLAN"
+	case svlans.All:
+		return "C-VLAN " + vlanListString(cvlans.Values)
+	case cvlans.All:
+		return "S-VLAN " + vlanListString(svlans.Values)
+	}
+	return fmt.Sprintf("S-VLAN %s C-VLAN %s", vlanListString(svlans.Values), vlanListString(cvlans.Values))
+}
+
+// flowTreatmentFields are the marking and policer fields compared between Flow Profiles matching the same frames, without the direction prefix
+var flowTreatmentFields = map[string][]string{
+	"Us": {"MarkPcp", "MarkPcpValue", "MarkDscp", "MarkDscpValue", "Cdr", "CdrBurstSize", "Pdr", "PdrBurstSize"},
+	"Ds": {"MarkPcp", "MarkPcpValue", "MarkDscp", "MarkDscpValue", "Cdr", "CdrBurstSize", "Pdr", "PdrBurstSize", "QueuingPriority", "SchedulingMode"},
+}
+
+// treatmentDiffs lists the fields of the direction the two Flow Profiles set differently,
+// a marking value is only compared when both profiles set the user value
+func treatmentDiffs(a, b *gopon.FlowProfile, dir string) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	var out []string
+	for _, k := range flowTreatmentFields[dir] {
+		name := dir + k
+		if strings.HasSuffix(name, "Value") {
+			mark := strings.TrimSuffix(name, "Value")
+			if va.FieldByName(mark).Int() != 3 || vb.FieldByName(mark).Int() != 3 {
+				continue
+			}
+		}
+		x, y := va.FieldByName(name).Int(), vb.FieldByName(name).Int()
+		if x != y {
+			out = append(out, fmt.Sprintf("%s %d/%d", name, x, y))
+		}
+	}
+	return out
+}
+
+var OverlapHeaders = []string{
+	"Dir",
+	"Service A",
+	"Flow A",
+	"Service B",
+	"Flow B",
+	"Shared VLANs",
+	"Overlap",
+	"Treatment A/B",
+}
+
+func relationString(r matchRelation, a, b string) string {
+	switch r {
+	case relEqual:
+		return "identical"
+	case relSubset:
+		return fmt.Sprintf("%s within %s", a, b)
+	case relSuperset:
+		return fmt.Sprintf("%s within %s", b, a)
+	case relOverlap:
+		return "partial"
+	}
+	return "none"
+}
+
+// analyzeOverlap checks each service in one direction and compares the Flow Profiles of services sharing VLANs,
+// returning the table rows and the warnings
+func analyzeOverlap(set *flowProfileSet, dir, service string) ([][]string, []string) {
+	var rows [][]string
+	var warnings []string
+	var services []*gopon.ServiceProfile
+	spaces := make(map[string]*flowSpace)
+	for _, sp := range set.Services {
+		fp, ok := set.Flows[sp.FlowProfileName]
+		if !ok {
+			continue
+		}
+		services = append(services, sp)
+		scope := newFlowVlanScope(set.Vlans[sp.VlanProfileName])
+		var s *flowSpace
+		if dir == "Us" {
+			s = newFlowSpace(flowMatchUs(fp), scope)
+		} else {
+			s = newFlowSpace(flowMatchDs(fp), scope)
+		}
+		spaces[sp.Name] = s
+		if service != "" && sp.Name != service {
+			continue
+		}
+		if s.Reason != "" {
+			warnings = append(warnings, fmt.Sprintf("Flow Profile %s of service %s never matches %s traffic: %s", fp.Name, sp.Name, strings.ToLower(dir), s.Reason))
+			continue
+		}
+		// upstream the ONU only sends what the ONU Flow Profile of the service carries
+		if ofp, ok := set.OnuFlows[sp.OnuFlowProfileName]; ok && dir == "Us" {
+			if s.relation(newFlowSpace(onuFlowMatch(ofp), nil)) == relDisjoint {
+				warnings = append(warnings, fmt.Sprintf("Flow Profile %s of service %s never matches us traffic, ONU Flow Profile %s carries none of the frames it matches", fp.Name, sp.Name, ofp.Name))
+			}
+		}
+	}
+	for i, a := range services {
+		for _, b := range services[i+1:] {
+			if service != "" && a.Name != service && b.Name != service {
+				continue
+			}
+			// services with the same Flow Profile treat the frames the same
+			if a.FlowProfileName == b.FlowProfileName {
+				continue
+			}
+			svlans, cvlans := sharedVlans(newFlowVlanScope(set.Vlans[a.VlanProfileName]), newFlowVlanScope(set.Vlans[b.VlanProfileName]))
+			if svlans.empty() || cvlans.empty() {
+				continue
+			}
+			vlans := sharedVlanString(svlans, cvlans)
+			r := spaces[a.Name].relation(spaces[b.Name])
+			if r == relDisjoint {
+				continue
+			}
+			fa, fb := set.Flows[a.FlowProfileName], set.Flows[b.FlowProfileName]
+			diffs := treatmentDiffs(fa, fb, dir)
+			treatment := "same"
+			if len(diffs) > 0 {
+				treatment = strings.Join(diffs, ", ")
+				warnings = append(warnings, fmt.Sprintf("Flow Profiles %s (%s) and %s (%s) match the same %s traffic on %s with a different %s", fa.Name, a.Name, fb.Name, b.Name, strings.ToLower(dir), vlans, strings.Join(diffs, ", ")))
+			}
+			switch r {
+			case relEqual:
+				warnings = append(warnings, fmt.Sprintf("Flow Profiles %s (%s) and %s (%s) have identical %s criteria on %s, only the one evaluated first ever matches", fa.Name, a.Name, fb.Name, b.Name, strings.ToLower(dir), vlans))
+			case relSubset:
+				warnings = append(warnings, fmt.Sprintf("Flow Profile %s (%s) is shadowed by %s (%s) on %s, it never matches %s traffic when %s is evaluated first", fa.Name, a.Name, fb.Name, b.Name, vlans, strings.ToLower(dir), fb.Name))
+			case relSuperset:
+				warnings = append(warnings, fmt.Sprintf("Flow Profile %s (%s) is shadowed by %s (%s) on %s, it never matches %s traffic when %s is evaluated first", fb.Name, b.Name, fa.Name, a.Name, vlans, strings.ToLower(dir), fa.Name))
+			}
+			rows = append(rows, []string{dir, a.Name, fa.Name, b.Name, fb.Name, vlans, relationString(r, fa.Name, fb.Name), treatment})
+		}
+	}
+	return rows, warnings
+}
+
+// overlapCommand runs `overlap`, reporting Flow Profiles that never match or match the same frames as another
+func overlapCommand(olt *gopon.LumiaOlt, args []string) error {
+	fs := flag.NewFlagSet("overlap", flag.ContinueOnError)
+	service := fs.String("service", "", "Only report on the Flow Profile of this Service Profile")
+	dir := fs.String("dir", "both", "Direction to analyze: us, ds or both")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	var dirs []string
+	switch strings.ToLower(*dir) {
+	case "us":
+		dirs = []string{"Us"}
+	case "ds":
+		dirs = []string{"Ds"}
+	case "both":
+		dirs = []string{"Us", "Ds"}
+	default:
+		return fmt.Errorf("unknown direction: %s", *dir)
+	}
+	set, err := getFlowProfileSet(olt)
+	if err != nil {
+		return err
+	}
+	if *service != "" {
+		var found bool
+		for _, sp := range set.Services {
+			if sp.Name == *service {
+				found = true
+			}
+		}
+		if !found {
+			return gopon.ErrNotExists
+		}
+	}
+	var rows [][]string
+	var warnings []string
+	for _, d := range dirs {
+		r, w := analyzeOverlap(set, d, *service)
+		rows = append(rows, r...)
+		warnings = append(warnings, w...)
+	}
+	if len(rows) > 0 {
+		tabwriteTable("Overlapping Flow Profiles", OverlapHeaders, rows)
+	} else {
+		fmt.Println("++ No Flow Profiles of services sharing a VLAN match the same frames")
+	}
+	for _, w := range warnings {
+		fmt.Printf("!! %s\n", w)
+	}
+	return nil
+}
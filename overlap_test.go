@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lindsaybb/gopon"
+)
+
+func TestSharedVlans(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *flowVlanScope
+		want string
+	}{
+		{"common C-VLANs", &flowVlanScope{CVlans: []int{100, 101}}, &flowVlanScope{CVlans: []int{101, 102}}, "C-VLAN 101"},
+		{"no common C-VLAN", &flowVlanScope{CVlans: []int{100}}, &flowVlanScope{CVlans: []int{200}}, ""},
+		{"same C-VLAN, other S-VLAN", &flowVlanScope{CVlans: []int{100}, SVlan: 10}, &flowVlanScope{CVlans: []int{100}, SVlan: 20}, ""},
+		{"same S-VLAN", &flowVlanScope{CVlans: []int{100}, SVlan: 10}, &flowVlanScope{CVlans: []int{100}, SVlan: 10}, "S-VLAN 10 C-VLAN 100"},
+		{"S-VLAN of one", &flowVlanScope{SVlan: 10}, &flowVlanScope{CVlans: []int{100}}, "S-VLAN 10 C-VLAN 100"},
+		{"missing VLAN Profile", nil, &flowVlanScope{CVlans: []int{100}}, "C-VLAN 100"},
+		{"both missing", nil, nil, "every VLAN"},
+	}
+	for _, tt := range tests {
+		svlans, cvlans := sharedVlans(tt.a, tt.b)
+		got := ""
+		if !svlans.empty() && !cvlans.empty() {
+			got = sharedVlanString(svlans, cvlans)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValueSetRelation(t *testing.T) {
+	tests := []struct {
+		a, b valueSet
+		want matchRelation
+	}{
+		{allValues(), allValues(), relEqual},
+		{allValues(), someValues(1), relSuperset},
+		{someValues(1), allValues(), relSubset},
+		{someValues(1, 2), someValues(2, 1), relEqual},
+		{someValues(1), someValues(1, 2), relSubset},
+		{someValues(1, 2), someValues(2, 3), relOverlap},
+		{someValues(1), someValues(2), relDisjoint},
+		{valueSet{}, allValues(), relDisjoint},
+	}
+	for _, tt := range tests {
+		if got := tt.a.relation(tt.b); got != tt.want {
+			t.Errorf("%+v to %+v: got %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCombineRelations(t *testing.T) {
+	tests := []struct {
+		list []matchRelation
+		want matchRelation
+	}{
+		{nil, relEqual},
+		{[]matchRelation{relEqual, relSubset}, relSubset},
+		{[]matchRelation{relSubset, relSuperset}, relOverlap},
+		{[]matchRelation{relSuperset, relOverlap, relDisjoint}, relDisjoint},
+	}
+	for _, tt := range tests {
+		if got := combineRelations(tt.list); got != tt.want {
+			t.Errorf("%v: got %d, want %d", tt.list, got, tt.want)
+		}
+	}
+}
+
+// overlapTestSet has voice matching PCP 5 within the any match of hsi
+func overlapTestSet(voiceVlan, hsiVlan *gopon.VlanProfile) *flowProfileSet {
+	voice := gopon.NewFlowProfile("voice")
+	voice.MatchUsCPcp = 5
+	voice.UsMarkPcp = 3
+	voice.UsMarkPcpValue = 5
+	hsi := gopon.NewFlowProfile("hsi")
+	hsi.MatchUsAny = 1
+	set := &flowProfileSet{
+		Services: []*gopon.ServiceProfile{
+			{Name: "voice", FlowProfileName: "voice", VlanProfileName: "v-voice"},
+			{Name: "hsi", FlowProfileName: "hsi", VlanProfileName: "v-hsi"},
+		},
+		Flows:    map[string]*gopon.FlowProfile{"voice": voice, "hsi": hsi},
+		OnuFlows: map[string]*gopon.OnuFlowProfile{},
+		Vlans:    map[string]*gopon.VlanProfile{},
+	}
+	if voiceVlan != nil {
+		set.Vlans["v-voice"] = voiceVlan
+	}
+	if hsiVlan != nil {
+		set.Vlans["v-hsi"] = hsiVlan
+	}
+	return set
+}
+
+func TestAnalyzeOverlap(t *testing.T) {
+	vlan := func(svid int, cvids ...int) *gopon.VlanProfile {
+		return &gopon.VlanProfile{CVid: vlanBitmapFromList(cvids), SVid: svid}
+	}
+	tests := []struct {
+		name    string
+		voice   *gopon.VlanProfile
+		hsi     *gopon.VlanProfile
+		want    [][]string
+		warning string
+	}{
+		{
+			name:    "shared C-VLAN",
+			voice:   vlan(0, 100),
+			hsi:     vlan(0, 100, 101),
+			want:    [][]string{{"Us", "voice", "voice", "hsi", "hsi", "C-VLAN 100", "voice within hsi", "UsMarkPcp 3/1"}},
+			warning: "Flow Profile voice (voice) is shadowed by hsi (hsi) on C-VLAN 100",
+		},
+		{
+			name:  "other S-VLAN",
+			voice: vlan(10, 100),
+			hsi:   vlan(20, 100),
+		},
+		{
+			name:    "voice has no VLAN Profile",
+			hsi:     vlan(20, 100),
+			want:    [][]string{{"Us", "voice", "voice", "hsi", "hsi", "S-VLAN 20 C-VLAN 100", "voice within hsi", "UsMarkPcp 3/1"}},
+			warning: "on S-VLAN 20 C-VLAN 100",
+		},
+	}
+	for _, tt := range tests {
+		rows, warnings := analyzeOverlap(overlapTestSet(tt.voice, tt.hsi), "Us", "")
+		if !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("%s: rows %q, want %q", tt.name, rows, tt.want)
+		}
+		if tt.warning == "" {
+			if len(warnings) > 0 {
+				t.Errorf("%s: warnings %q", tt.name, warnings)
+			}
+			continue
+		}
+		var found bool
+		for _, w := range warnings {
+			if strings.Contains(w, tt.warning) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: no warning %q in %q", tt.name, tt.warning, warnings)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// qosClass is a Flow Profile template setting the QoS fields, Parameters are prompted for with the template value as default
+type qosClass struct {
+	Name        string         `json:"-"`
+	Description string         `json:"description"`
+	Parameters  []string       `json:"parameters"`
+	Fields      map[string]int `json:"fields"`
+}
+
+// qosClassFieldRanges are the Flow Profile fields a QoS Class can set, by gopon.FlowProfile field name, with the settable range
+var qosClassFieldRanges = map[string][2]int{
+	"MatchUsCPcp":       {-1, 7},
+	"MatchUsIPDscp":     {-1, 63},
+	"MatchDsCPcp":       {-1, 7},
+	"MatchDsIPDscp":     {-1, 63},
+	"UsCdr":             {0, 1000000},
+	"UsCdrBurstSize":    {0, 16384},
+	"UsPdr":             {0, 1000000},
+	"UsPdrBurstSize":    {0, 16384},
+	"UsMarkPcp":         {1, 3},
+	"UsMarkPcpValue":    {-1, 7},
+	"UsMarkDscp":        {1, 3},
+	"UsMarkDscpValue":   {-1, 63},
+	"DsCdr":             {0, 1000000},
+	"DsCdrBurstSize":    {0, 16384},
+	"DsPdr":             {0, 1000000},
+	"DsPdrBurstSize":    {0, 16384},
+	"DsMarkPcp":         {1, 3},
+	"DsMarkPcpValue":    {-1, 7},
+	"DsMarkDscp":        {1, 3},
+	"DsMarkDscpValue":   {-1, 63},
+	"DsQueuingPriority": {0, 7},
+	"DsSchedulingMode":  {1, 2},
+}
+
+var QosClassHeaders = []string{
+	"Class",
+	"Description",
+	"PCP",
+	"DSCP",
+	"Us CDR/PDR",
+	"Us Burst",
+	"Ds CDR/PDR",
+	"Ds Burst",
+	"Queue",
+	"Scheduling",
+	"Parameters",
+}
+
+var QosClassOperations = []string{
+	"Apply QoS Class",
+	"Save Profile as QoS Class",
+}
+
+// qosClassRates are prompted for when a class is applied, the other fields rarely change per service
+var qosClassRates = []string{"UsCdr", "UsPdr", "DsCdr", "DsPdr"}
+
+// qosClassBurstFields are the burst sizes that follow each rate of a class
+var qosClassBurstFields = map[string]string{
+	"UsCdr": "UsCdrBurstSize",
+	"UsPdr": "UsPdrBurstSize",
+	"DsCdr": "DsCdrBurstSize",
+	"DsPdr": "DsPdrBurstSize",
+}
+
+// qosClassBurst is the recommended burst size for a rate of the class, 0 leaves an unset rate to the OLT default
+func qosClassBurst(rateKbps int) int {
+	if rateKbps == 0 {
+		return 0
+	}
+	return recommendedBurstSize(rateKbps, defaultBurstRtt)
+}
+
+// newQosClass marks both directions with the same PCP and DSCP, matching them upstream
+func newQosClass(name, description string, pcp, dscp, cdr, pdr, queue, mode int) *qosClass {
+	return &qosClass{
+		Name:        name,
+		Description: description,
+		Parameters:  qosClassRates,
+		Fields: map[string]int{
+			"MatchUsCPcp":       pcp,
+			"MatchUsIPDscp":     dscp,
+			"UsCdr":             cdr,
+			"UsCdrBurstSize":    qosClassBurst(cdr),
+			"UsPdr":             pdr,
+			"UsPdrBurstSize":    qosClassBurst(pdr),
+			"UsMarkPcp":         3,
+			"UsMarkPcpValue":    pcp,
+			"UsMarkDscp":        3,
+			"UsMarkDscpValue":   dscp,
+			"DsCdr":             cdr,
+			"DsCdrBurstSize":    qosClassBurst(cdr),
+			"DsPdr":             pdr,
+			"DsPdrBurstSize":    qosClassBurst(pdr),
+			"DsMarkPcp":         3,
+			"DsMarkPcpValue":    pcp,
+			"DsMarkDscp":        3,
+			"DsMarkDscpValue":   dscp,
+			"DsQueuingPriority": queue,
+			"DsSchedulingMode":  mode,
+		},
+	}
+}
+
+// defaultQosClasses are written to the preset directory the first time it is used
+func defaultQosClasses() []*qosClass {
+	return []*qosClass{
+		newQosClass("voice", "VoIP bearer and signalling, EF with strict priority", 5, 46, 256, 256, 7, 2),
+		newQosClass("video", "IPTV and video conferencing, AF41", 4, 34, 8000, 20000, 5, 1),
+		newQosClass("best-effort", "Internet access, no commitment", 0, 0, 0, 100000, 0, 1),
+		newQosClass("management", "ONU and CPE management, CS6 with strict priority", 6, 48, 512, 2048, 6, 2),
+	}
+}
+
+func qosClassDir() (string, error) {
+	return presetDir("flow", func(dir string) error {
+		for _, c := range defaultQosClasses() {
+			err := saveQosClass(dir, c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func saveQosClass(dir string, c *qosClass) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, c.Name+".json"), append(data, '\n'), 0644)
+}
+
+// validate checks every field and parameter is a settable QoS field within its range
+func (c *qosClass) validate() error {
+	for k, v := range c.Fields {
+		r, ok := qosClassFieldRanges[k]
+		if !ok {
+			return fmt.Errorf("%s is not a QoS field of the Flow Profile", k)
+		}
+		if v < r[0] || v > r[1] {
+			return fmt.Errorf("%s: %d is out of range (%d...%d)", k, v, r[0], r[1])
+		}
+	}
+	for _, k := range c.Parameters {
+		if _, ok := qosClassFieldRanges[k]; !ok {
+			return fmt.Errorf("parameter %s is not a QoS field of the Flow Profile", k)
+		}
+	}
+	return nil
+}
+
+// getQosClasses reads every class file in the directory, sorted by name
+func getQosClasses(dir string) ([]*qosClass, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var list []*qosClass
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var c qosClass
+		err = json.Unmarshal(data, &c)
+		if err == nil {
+			err = c.validate()
+		}
+		if err != nil {
+			fmt.Printf("!! Skipping QoS Class %s: %v\n", f, err)
+			continue
+		}
+		c.Name = strings.TrimSuffix(filepath.Base(f), ".json")
+		list = append(list, &c)
+	}
+	return list, nil
+}
+
+// field returns the class value of a Flow Profile field, or - when the class does not set it
+func (c *qosClass) field(name string) string {
+	v, ok := c.Fields[name]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+func tabwriteQosClasses(list []*qosClass) {
+	var rows [][]string
+	for _, c := range list {
+		mode := "-"
+		if v, ok := c.Fields["DsSchedulingMode"]; ok && v > 0 && v < len(gopon.FlowProfileSchedulingModes) {
+			mode = gopon.FlowProfileSchedulingModes[v]
+		}
+		rows = append(rows, []string{
+			c.Name,
+			c.Description,
+			c.field("UsMarkPcpValue"),
+			c.field("UsMarkDscpValue"),
+			c.field("UsCdr") + "/" + c.field("UsPdr"),
+			c.field("UsCdrBurstSize") + "/" + c.field("UsPdrBurstSize"),
+			c.field("DsCdr") + "/" + c.field("DsPdr"),
+			c.field("DsCdrBurstSize") + "/" + c.field("DsPdrBurstSize"),
+			c.field("DsQueuingPriority"),
+			mode,
+			strings.Join(c.Parameters, ","),
+		})
+	}
+	tabwriteTable("QoS Classes", QosClassHeaders, rows)
+}
+
+// apply sets the class fields on the Flow Profile, prompting for the parameters, a burst size the class
+// derives from its rate is recomputed for the rate provided, one the class sets to another value is kept
+func (c *qosClass) apply(fp *gopon.FlowProfile) error {
+	values := make(map[string]int)
+	for k, v := range c.Fields {
+		values[k] = v
+	}
+	for _, k := range c.Parameters {
+		r := qosClassFieldRanges[k]
+		fmt.Printf(">> %s [%d], provide value (%d...%d) or leave empty for the default:\n>> ", k, values[k], r[0], r[1])
+		input := sanitizeInput(readFromStdin())
+		if input == "" {
+			continue
+		}
+		i, err := strconv.Atoi(input)
+		if err != nil {
+			return gopon.ErrNotInput
+		}
+		if i < r[0] || i > r[1] {
+			return fmt.Errorf("%s: %d is out of range (%d...%d)", k, i, r[0], r[1])
+		}
+		values[k] = i
+		b, ok := qosClassBurstFields[k]
+		if !ok {
+			continue
+		}
+		if burst, ok := c.Fields[b]; ok && burst != qosClassBurst(c.Fields[k]) {
+			continue
+		}
+		values[b] = qosClassBurst(i)
+		fmt.Printf("++ %s set to %d for the new rate\n", b, values[b])
+	}
+	v := reflect.ValueOf(fp).Elem()
+	for k, i := range values {
+		v.FieldByName(k).SetInt(int64(i))
+	}
+	return nil
+}
+
+// newQosClassFromFlowProfile takes every QoS field of the Flow Profile, with the rates as parameters
+func newQosClassFromFlowProfile(fp *gopon.FlowProfile) *qosClass {
+	c := &qosClass{Parameters: qosClassRates, Fields: make(map[string]int)}
+	v := reflect.ValueOf(fp).Elem()
+	for k := range qosClassFieldRanges {
+		c.Fields[k] = int(v.FieldByName(k).Int())
+	}
+	return c
+}
+
+// qosClassHandler applies a QoS Class to the Flow Profile being modified, or saves its QoS fields as a new class
+func qosClassHandler(fp *gopon.FlowProfile) (*gopon.FlowProfile, error) {
+	dir, err := qosClassDir()
+	if err != nil {
+		return nil, err
+	}
+	list, err := getQosClasses(dir)
+	if err != nil {
+		return nil, err
+	}
+	tabwriteQosClasses(list)
+	fmt.Println(">> What would you like to do?")
+	printList(QosClassOperations)
+	fmt.Print(">> ")
+	arg := strings.ToLower(sanitizeInput(readFromStdin()))
+	switch getIntFromArg(arg, QosClassOperations) {
+	case 0:
+		fmt.Print(">> Which QoS Class would you like to apply?\n>> ")
+		name := sanitizeInput(readFromStdin())
+		for _, c := range list {
+			if c.Name == name {
+				err = c.apply(fp)
+				if err != nil {
+					return nil, err
+				}
+				return fp, nil
+			}
+		}
+		return nil, gopon.ErrNotExists
+	case 1:
+		c := newQosClassFromFlowProfile(fp)
+		fmt.Print(">> Provide the name of the new QoS Class\n>> ")
+		c.Name = sanitizeInput(readFromStdin())
+		if c.Name == "" {
+			return nil, gopon.ErrNotInput
+		}
+		if _, err = os.Stat(filepath.Join(dir, c.Name+".json")); err == nil {
+			fmt.Printf(">> QoS Class %s exists, overwrite it? (y/N)\n>> ", c.Name)
+			input := strings.ToLower(sanitizeInput(readFromStdin()))
+			if input != "y" {
+				return fp, nil
+			}
+		}
+		fmt.Print(">> Provide a description of the QoS Class\n>> ")
+		c.Description = strings.TrimSpace(readFromStdin())
+		err = saveQosClass(dir, c)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("++ Saved QoS Class %s in %s, edit the file to change which fields are set or prompted for\n", c.Name, dir)
+		return fp, nil
+	default:
+		return nil, gopon.ErrNotInput
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// restSessionCookie is the session gopon sends, with the credentials of the active OLT of the inventory,
+// as gopon only builds urls for the tables it knows
+func restSessionCookie() string {
+	user, pw, err := activeOlt.credentials()
+	if err != nil {
+		user, pw = "admin", "admin"
+	}
+	return fmt.Sprintf("session=em+protection-user=%s&em+protection-pw=%s", user, pw)
+}
+
+// restRequest performs a request on a path below the MIB root with the credentials and timeout of the active OLT
+func restRequest(method, host, path string, data []byte) (*http.Response, error) {
+	reqUrl := fmt.Sprintf("https://%s/restconf/data/ISKRATEL-MSAN-MIB:ISKRATEL-MSAN-MIB/%s", host, path)
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	client := &http.Client{Transport: tr, Timeout: activeOlt.timeout}
+	req, err := http.NewRequest(method, reqUrl, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Cookie", restSessionCookie())
+	req.Header.Set("Content-Type", "application/json")
+	return client.Do(req)
+}
+
+// restTableRequest performs a request on a single entry of any table, the key is the comma-joined list index
+func restTableRequest(method, host, table, entry, key string, data []byte) (string, error) {
+	resp, err := restRequest(method, host, fmt.Sprintf("%s/%s=%s", table, entry, key), data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return resp.Status, nil
+}
+
+// getRawTableEntries returns the entries of a table as raw json, so that fields gopon does not model are kept
+func getRawTableEntries(olt *gopon.LumiaOlt, table, entry string) ([]json.RawMessage, error) {
+	resp, err := restRequest("GET", olt.Host, table, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	rawJson, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var entries []json.RawMessage
+	err = findRawEntries(rawJson, entry, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// findRawEntries descends through the nested module and table objects until it finds the entry list
+func findRawEntries(raw json.RawMessage, entry string, entries *[]json.RawMessage) error {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil {
+		// not an object, nothing further to search
+		return nil
+	}
+	if v, ok := obj[entry]; ok {
+		return json.Unmarshal(v, entries)
+	}
+	for _, v := range obj {
+		err := findRawEntries(v, entry, entries)
+		if err != nil {
+			return err
+		}
+		if len(*entries) > 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// rawColumn is a column of an OLT table that gopon does not model, it is looked up among the columns the OLT
+// reports for an entry by the endings its name may have, so a column the firmware does not have is never posted
+type rawColumn struct {
+	Header  string
+	Endings []string
+}
+
+// reportedColumn is a rawColumn as the OLT reported it for an entry
+type reportedColumn struct {
+	Name  string
+	Value json.RawMessage
+}
+
+// reportedColumns are the rawColumns found in an entry, by header
+type reportedColumns map[string]*reportedColumn
+
+// modelFields collects the json names of the fields of a gopon model, including those of embedded structs
+func modelFields(t reflect.Type, fields map[string]bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			modelFields(f.Type, fields)
+			continue
+		}
+		if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+}
+
+// findReportedColumns looks up the columns in a raw entry, leaving out the fields of the model so a column gopon
+// already handles is not matched again, and a column whose endings match more than one reported name
+func findReportedColumns(raw json.RawMessage, model interface{}, columns []rawColumn) (reportedColumns, error) {
+	var obj map[string]json.RawMessage
+	err := json.Unmarshal(raw, &obj)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	modelFields(reflect.TypeOf(model), known)
+	found := make(reportedColumns)
+	for _, c := range columns {
+		var match []string
+		for name := range obj {
+			if known[name] {
+				continue
+			}
+			lower := strings.ToLower(name)
+			for _, e := range c.Endings {
+				if strings.HasSuffix(lower, strings.ToLower(e)) {
+					match = append(match, name)
+					break
+				}
+			}
+		}
+		if len(match) == 1 {
+			found[c.Header] = &reportedColumn{Name: match[0], Value: obj[match[0]]}
+		}
+	}
+	return found, nil
+}
+
+// copy returns columns that can be edited without changing those of the original profile
+func (c reportedColumns) copy() reportedColumns {
+	n := make(reportedColumns, len(c))
+	for h, rc := range c {
+		v := *rc
+		v.Value = append(json.RawMessage(nil), rc.Value...)
+		n[h] = &v
+	}
+	return n
+}
+
+// require tells the user when the OLT did not report the column, which is then not offered
+func (c reportedColumns) require(header, table string) bool {
+	if _, ok := c[header]; ok {
+		return true
+	}
+	fmt.Printf("!! The OLT reports no %s column in its %s, it cannot be set from ponPro\n", header, table)
+	return false
+}
+
+func (c reportedColumns) intValue(header string) (int, bool) {
+	rc, ok := c[header]
+	if !ok {
+		return 0, false
+	}
+	var v int
+	if json.Unmarshal(rc.Value, &v) != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+func (c reportedColumns) setInt(header string, v int) {
+	if rc, ok := c[header]; ok {
+		rc.Value = json.RawMessage(strconv.Itoa(v))
+	}
+}
+
+// cell shows a reported integer column in a table, or that the OLT does not report it
+func (c reportedColumns) cell(header string, format func(int) string) string {
+	v, ok := c.intValue(header)
+	if !ok {
+		return "Not reported"
+	}
+	return format(v)
+}
+
+// merge adds the reported columns to the json ponPro posts for the gopon model
+func (c reportedColumns) merge(data []byte) ([]byte, error) {
+	if len(c) == 0 {
+		return data, nil
+	}
+	var obj map[string]json.RawMessage
+	err := json.Unmarshal(data, &obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, rc := range c {
+		obj[rc.Name] = rc.Value
+	}
+	return json.Marshal(obj)
+}
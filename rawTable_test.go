@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lindsaybb/gopon"
+)
+
+func TestFindReportedColumns(t *testing.T) {
+	raw := json.RawMessage(`{
+		"msanMulticastProfileName": "iptv",
+		"msanMulticastProfileMulticastGroupLimit": 8,
+		"msanMulticastProfileIgmpQueryInterval": 60,
+		"msanMulticastProfileRobustnessVariable": 3,
+		"msanMulticastProfileAGroupRate": 1,
+		"msanMulticastProfileBGroupRate": 2
+	}`)
+	columns := []rawColumn{
+		{"Query Interval", []string{"QueryInterval"}},
+		{"Robustness", []string{"Robustness", "RobustnessVariable"}},
+		{"Group Limit", []string{"GroupLimit"}},
+		{"Group Rate", []string{"GroupRate"}},
+		{"Last Member", []string{"LastMemberQueryInterval"}},
+	}
+	found, err := findReportedColumns(raw, gopon.IgmpProfile{}, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		header string
+		name   string
+		value  int
+	}{
+		{"Query Interval", "msanMulticastProfileIgmpQueryInterval", 60},
+		{"Robustness", "msanMulticastProfileRobustnessVariable", 3},
+		// modelled by gopon, ambiguous and not reported
+		{"Group Limit", "", 0},
+		{"Group Rate", "", 0},
+		{"Last Member", "", 0},
+	}
+	for _, tt := range tests {
+		rc, ok := found[tt.header]
+		if tt.name == "" {
+			if ok {
+				t.Errorf("%s: found %s", tt.header, rc.Name)
+			}
+			continue
+		}
+		if !ok || rc.Name != tt.name {
+			t.Errorf("%s: got %v, want %s", tt.header, rc, tt.name)
+			continue
+		}
+		if v, _ := found.intValue(tt.header); v != tt.value {
+			t.Errorf("%s: value %d, want %d", tt.header, v, tt.value)
+		}
+	}
+}
+
+func TestReportedColumnsMerge(t *testing.T) {
+	c := reportedColumns{"Robustness": {Name: "msanMulticastProfileIgmpRobustness", Value: json.RawMessage("2")}}
+	n := c.copy()
+	n.setInt("Robustness", 4)
+	n.setInt("Query Interval", 90)
+	if v, _ := c.intValue("Robustness"); v != 2 {
+		t.Errorf("the copy changed the original to %d", v)
+	}
+	data, err := n.merge([]byte(`{"msanMulticastProfileName":"iptv"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"msanMulticastProfileIgmpRobustness":4,"msanMulticastProfileName":"iptv"}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+	if n.cell("Query Interval", func(int) string { return "set" }) != "Not reported" {
+		t.Errorf("a column that is not reported was set")
+	}
+}
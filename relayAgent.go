@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// relayOptionMaxLen is the most a format may hold, option lengths are a single octet
+const relayOptionMaxLen = 255
+
+// getRelayTemplate prompts for a custom format, an empty input keeps the current format and - clears it
+func getRelayTemplate(name, current string) (string, error) {
+	fmt.Println("++ The format is posted as written, the OLT expands it with the format tokens of its firmware")
+	fmt.Printf(">> %s is currently [%v], provide new format or - to use the OLT default:\n>> ", name, current)
+	// the format keeps braces and spaces, so it is not passed through sanitizeInput
+	format := strings.TrimSpace(readFromStdin())
+	switch format {
+	case "":
+		return current, nil
+	case "-":
+		return "", nil
+	}
+	if len(format) > relayOptionMaxLen {
+		fmt.Printf("!! A format of more than %d bytes does not fit in the option, not set\n", relayOptionMaxLen)
+		return current, nil
+	}
+	return format, nil
+}
+
+// toggleRelayValue flips a 1: enabled, 0: disabled value after confirmation
+func toggleRelayValue(name string, v int) int {
+	fmt.Printf(">> %s is currently [%v], toggle status? (Y/n)\n>> ", name, enabledString(v))
+	togBool := strings.ToLower(sanitizeInput(readFromStdin()))
+	if togBool == "y" || togBool == "" {
+		if v == 1 {
+			return 0
+		}
+		return 1
+	}
+	return v
+}
+
+// getRelayIntValue prompts for a value in the range min...max, an empty input keeps the current value
+func getRelayIntValue(name string, current, min, max int) (int, error) {
+	fmt.Printf(">> %s is currently [%v], provide new value (%d...%d):\n>> ", name, current, min, max)
+	newInt := sanitizeInput(readFromStdin())
+	if newInt == "" {
+		return current, nil
+	}
+	i, err := strconv.Atoi(newInt)
+	if err != nil {
+		return current, gopon.ErrNotInput
+	}
+	if i < min || i > max {
+		fmt.Println("!! Value out of range, not set")
+		return current, nil
+	}
+	return i, nil
+}
+
+// DhcpRaHeaders lists the DHCP Relay Agent settings of the Service Profile, the only digit in the names is
+// the 6 of DHCPv6, which is listed after the sixth setting so that selecting by number is not matched by name first
+var DhcpRaHeaders = []string{
+	"DHCP RA",
+	"Trust Clients",
+	"Insert Agent Options",
+	"Unicast Extension",
+	"Rate Limit",
+	"Circuit-ID Type",
+	"Circuit-ID Format",
+	"Remote-ID Format",
+	"DHCPv6 LDRA",
+	"DHCPv6 Trust Clients",
+	"Interface-ID Type",
+	"Interface-ID Format",
+	"Remote-ID Enterprise Number",
+	"DHCPv6 Remote-ID Format",
+}
+
+func tabwriteDhcpRa(sp *gopon.ServiceProfile) {
+	row := []string{
+		enabledString(sp.DhcpRa),
+		enabledString(sp.DhcpRaTrustClients),
+		enabledString(sp.DhcpRaOpt82Insert),
+		enabledString(sp.DhcpRaOpt82UnicastExtension),
+		fmt.Sprintf("%d/s", sp.DhcpRaRateLimit),
+		fmt.Sprintf("%d", sp.DhcpRaCircuitIDType),
+		sp.DhcpRaCircuitIDCustomFormat,
+		sp.DhcpRaRemoteIDCustomFormat,
+		enabledString(sp.Dhcpv6Ra),
+		enabledString(sp.Dhcpv6RaTrustClients),
+		fmt.Sprintf("%d", sp.Dhcpv6RaInterfaceIDType),
+		sp.Dhcpv6RaInterfaceIDCustomFormat,
+		fmt.Sprintf("%d", sp.Dhcpv6RaRemoteIDEnterpriseNum),
+		sp.Dhcpv6RaRemoteIDCustomFormat,
+	}
+	tabwriteTable("DHCP Relay Agent", DhcpRaHeaders, [][]string{row})
+}
+
+// modifyDhcpRaSettings edits the DHCP Relay Agent settings of the Service Profile until no further changes are requested
+func modifyDhcpRaSettings(olt *gopon.LumiaOlt, sp *gopon.ServiceProfile) (*gopon.ServiceProfile, error) {
+	var err error
+	tabwriteDhcpRa(sp)
+	arg := getArgFromSelection(DhcpRaHeaders)
+	for {
+		modVal := getIntFromArg(arg, DhcpRaHeaders)
+		switch modVal {
+		case 0:
+			fmt.Println("++ The DHCP Relay Agent intercepts DHCPv4 requests of the subscribers")
+			sp.DhcpRa = toggleRelayValue("DHCP RA", sp.DhcpRa)
+		case 1:
+			fmt.Println("++ Trusted clients may send requests that already carry option 82")
+			sp.DhcpRaTrustClients = toggleRelayValue("Trust Clients", sp.DhcpRaTrustClients)
+		case 2:
+			fmt.Println("++ Insert option 82 with the Circuit-ID and Remote-ID into the relayed requests")
+			sp.DhcpRaOpt82Insert = toggleRelayValue("Option 82 Insert", sp.DhcpRaOpt82Insert)
+		case 3:
+			fmt.Println("++ Also insert option 82 into unicast requests, such as renewals")
+			sp.DhcpRaOpt82UnicastExtension = toggleRelayValue("Option 82 Unicast Extension", sp.DhcpRaOpt82UnicastExtension)
+		case 4:
+			fmt.Println("++ Maximum DHCP messages per second accepted from a subscriber, default is 5")
+			sp.DhcpRaRateLimit, err = getRelayIntValue("Rate Limit", sp.DhcpRaRateLimit, 1, 100)
+		case 5:
+			fmt.Println("++ Circuit-ID Type 1 uses the OLT default format, the custom format is used with the custom type")
+			sp.DhcpRaCircuitIDType, err = getRelayIntValue("Circuit-ID Type", sp.DhcpRaCircuitIDType, 1, 4)
+		case 6:
+			sp.DhcpRaCircuitIDCustomFormat, err = getRelayTemplate("Circuit-ID Format", sp.DhcpRaCircuitIDCustomFormat)
+		case 7:
+			sp.DhcpRaRemoteIDCustomFormat, err = getRelayTemplate("Remote-ID Format", sp.DhcpRaRemoteIDCustomFormat)
+		case 8:
+			fmt.Println("++ The Lightweight DHCPv6 Relay Agent adds options 18 and 37 to the subscriber requests")
+			sp.Dhcpv6Ra = toggleRelayValue("DHCPv6 LDRA", sp.Dhcpv6Ra)
+		case 9:
+			fmt.Println("++ Trusted clients may send Relay-Forward messages of their own")
+			sp.Dhcpv6RaTrustClients = toggleRelayValue("DHCPv6 Trust Clients", sp.Dhcpv6RaTrustClients)
+		case 10:
+			fmt.Println("++ Interface-ID (option 18) Type, default is 2, the custom format is used with the custom type")
+			sp.Dhcpv6RaInterfaceIDType, err = getRelayIntValue("Interface-ID Type", sp.Dhcpv6RaInterfaceIDType, 1, 4)
+		case 11:
+			sp.Dhcpv6RaInterfaceIDCustomFormat, err = getRelayTemplate("Interface-ID Format", sp.Dhcpv6RaInterfaceIDCustomFormat)
+		case 12:
+			fmt.Println("++ IANA Enterprise Number sent with the Remote-ID (option 37), default is 1332")
+			sp.Dhcpv6RaRemoteIDEnterpriseNum, err = getRelayIntValue("Remote-ID Enterprise Number", sp.Dhcpv6RaRemoteIDEnterpriseNum, 0, 2147483647)
+		case 13:
+			sp.Dhcpv6RaRemoteIDCustomFormat, err = getRelayTemplate("DHCPv6 Remote-ID Format", sp.Dhcpv6RaRemoteIDCustomFormat)
+		default:
+			fmt.Println("!! Unexpected value, no change made")
+		}
+		if err != nil {
+			return nil, err
+		}
+		tabwriteDhcpRa(sp)
+		fmt.Print(">> Modify further DHCP RA settings? (y/N)\n>> ")
+		modBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if modBool == "y" {
+			arg = getArgFromSelection(DhcpRaHeaders)
+		} else {
+			break
+		}
+	}
+	return sp, nil
+}
+
+// PppoeIaHeaders lists the PPPoE Intermediate Agent settings of the Service Profile
+var PppoeIaHeaders = []string{
+	"PPPoE IA",
+	"Tag Trust",
+	"Rate Limit",
+	"Circuit-ID Type",
+	"Circuit-ID Format",
+	"Remote-ID Format",
+}
+
+// pppoeIaColumns are looked up in the entries of the service profile table, gopon does not model the tag trust
+var pppoeIaColumns = []rawColumn{
+	{"Tag Trust", []string{"PppoeIATrust", "PppoeIATrustClients", "PppoeIATagTrust"}},
+}
+
+func tabwritePppoeIa(sp *gopon.ServiceProfile, columns reportedColumns) {
+	row := []string{
+		enabledString(sp.PppoeIA),
+		columns.cell("Tag Trust", enabledString),
+		fmt.Sprintf("%d/s", sp.PppoeIARateLimit),
+		fmt.Sprintf("%d", sp.PPPoeIACircuitIDType),
+		sp.PPPoeIACircuitIDCustomFormat,
+		sp.PPPoeIARemoteIDCustomFormat,
+	}
+	tabwriteTable("PPPoE Intermediate Agent", PppoeIaHeaders, [][]string{row})
+}
+
+// modifyPppoeIaSettings edits the PPPoE Intermediate Agent settings of the Service Profile until no further changes are requested,
+// the tag trust is edited in the columns and only when the OLT reports it
+func modifyPppoeIaSettings(olt *gopon.LumiaOlt, sp *gopon.ServiceProfile, columns reportedColumns) (*gopon.ServiceProfile, error) {
+	var err error
+	tabwritePppoeIa(sp, columns)
+	arg := getArgFromSelection(PppoeIaHeaders)
+	for {
+		modVal := getIntFromArg(arg, PppoeIaHeaders)
+		switch modVal {
+		case 0:
+			fmt.Println("++ The PPPoE Intermediate Agent adds the vendor-specific tag to the discovery frames of the subscribers")
+			sp.PppoeIA = toggleRelayValue("PPPoE IA", sp.PppoeIA)
+		case 1:
+			if !columns.require("Tag Trust", "service profile table") {
+				break
+			}
+			v, _ := columns.intValue("Tag Trust")
+			if v != 0 && v != 1 {
+				fmt.Printf("!! The OLT reports Tag Trust as [%d], which ponPro does not know, no change made\n", v)
+				break
+			}
+			fmt.Println("++ Trusted subscribers may send discovery frames that already carry the vendor-specific tag")
+			columns.setInt("Tag Trust", toggleRelayValue("Tag Trust", v))
+		case 2:
+			fmt.Println("++ Maximum PPPoE discovery frames per second accepted from a subscriber, default is 5")
+			sp.PppoeIARateLimit, err = getRelayIntValue("Rate Limit", sp.PppoeIARateLimit, 1, 100)
+		case 3:
+			fmt.Println("++ Circuit-ID Type 1 uses the OLT default format, the custom format is used with the custom type")
+			sp.PPPoeIACircuitIDType, err = getRelayIntValue("Circuit-ID Type", sp.PPPoeIACircuitIDType, 1, 4)
+		case 4:
+			sp.PPPoeIACircuitIDCustomFormat, err = getRelayTemplate("Circuit-ID Format", sp.PPPoeIACircuitIDCustomFormat)
+		case 5:
+			sp.PPPoeIARemoteIDCustomFormat, err = getRelayTemplate("Remote-ID Format", sp.PPPoeIARemoteIDCustomFormat)
+		default:
+			fmt.Println("!! Unexpected value, no change made")
+		}
+		if err != nil {
+			return nil, err
+		}
+		tabwritePppoeIa(sp, columns)
+		fmt.Print(">> Modify further PPPoE IA settings? (y/N)\n>> ")
+		modBool := strings.ToLower(sanitizeInput(readFromStdin()))
+		if modBool == "y" {
+			arg = getArgFromSelection(PppoeIaHeaders)
+		} else {
+			break
+		}
+	}
+	return sp, nil
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+// securityPreset is a named Security Profile baseline stored as a file, the profile Name and Usage are not used
+type securityPreset struct {
+	Name        string                `json:"-"`
+	Description string                `json:"description"`
+	Profile     gopon.SecurityProfile `json:"profile"`
+}
+
+var SecurityPresetHeaders = []string{
+	"Preset",
+	"Description",
+	"Protect",
+	"MAC-SG",
+	"MAC-Limit",
+	"Port-Sec",
+	"DAI",
+	"IPv4-SG",
+	"IPv6-SG",
+	"Storm-Control",
+	"App-Rate-Limit",
+}
+
+var SecurityPresetOperations = []string{
+	"Apply Preset",
+	"Save Profile as Preset",
+}
+
+// defaultSecurityPresets are written to the preset directory the first time it is used
+func defaultSecurityPresets() []*securityPreset {
+	residential := gopon.NewSecurityProfile("")
+	residential.SetMacSG(true)
+	residential.SetMacLimit(4)
+	residential.SetPortSecurity(true)
+	residential.SetArpInspect(true)
+	residential.SetIPv4SG(true)
+	residential.SetIPv6SG(true)
+	residential.SetStormControl([]int{100, 100, 100})
+	residential.SetAppRateLimit("STP", 0)
+
+	business := gopon.NewSecurityProfile("")
+	business.SetMacSG(true)
+	business.SetMacLimit(16)
+	business.SetPortSecurity(true)
+	business.SetStormControl([]int{500, 1000, 1000})
+	business.SetAppRateLimit("DHCP", 20)
+	business.SetAppRateLimit("IGMP", 20)
+	business.SetAppRateLimit("PPPOE", 20)
+	business.SetAppRateLimit("STP", 10)
+
+	wholesale := gopon.NewSecurityProfile("")
+	wholesale.SetStormControl([]int{1000, 5000, 5000})
+	for i := range gopon.SecArlList {
+		wholesale.SetARL(i, -1)
+	}
+
+	lab := gopon.NewSecurityProfile("")
+	lab.ProtectedPort = 0
+	lab.SetStormControl([]int{-1, -1, -1})
+	for i := range gopon.SecArlList {
+		lab.SetARL(i, -1)
+	}
+
+	return []*securityPreset{
+		{Name: "residential", Description: "Single subscriber, source guard and DAI, tight storm control", Profile: *residential},
+		{Name: "business", Description: "Multiple hosts behind the ONU, port security with a larger MAC limit", Profile: *business},
+		{Name: "wholesale", Description: "Transparent L2 for a retail provider, storm control only", Profile: *wholesale},
+		{Name: "lab", Description: "No protection, for testing only", Profile: *lab},
+	}
+}
+
+// validate checks the preset only holds values the Security Profile editor can set, the MAC limit
+// within the 1...16 of gopon SetMacLimit, or 0 when it is not defined
+func (p *securityPreset) validate() error {
+	sp := &p.Profile
+	flags := []struct {
+		name  string
+		value int
+	}{
+		{"ProtectedPort", sp.ProtectedPort},
+		{"MacSg", sp.MacSg},
+		{"PortSecurity", sp.PortSecurity},
+		{"ArpInspect", sp.ArpInspect},
+		{"IpSg", sp.IPSg},
+		{"IpSgIpv6", sp.IPSgIpv6},
+	}
+	for _, f := range flags {
+		if f.value != 0 && f.value != 1 {
+			return fmt.Errorf("%s: %d is not 0 or 1", f.name, f.value)
+		}
+	}
+	if sp.MacLimit < 0 || sp.MacLimit > 16 {
+		return fmt.Errorf("MacLimit: %d is out of range (0...16)", sp.MacLimit)
+	}
+	if sp.IPSgFilteringMode != 1 && sp.IPSgFilteringMode != 2 {
+		return fmt.Errorf("IpSgFilteringMode: %d is not 1 (IP) or 2 (IP & MAC)", sp.IPSgFilteringMode)
+	}
+	for _, v := range []int{sp.IPSgBindingLimit, sp.IPSgBindingLimitDhcpv6, sp.IPSgBindingLimitND} {
+		if v < 0 || v > 15 {
+			return fmt.Errorf("IP-SG binding limit: %d is out of range (0...15)", v)
+		}
+	}
+	for i, v := range sp.GetStormControl() {
+		if v < -1 || v > 65535 {
+			return fmt.Errorf("Storm Control %s: %d is out of range (0...65535, or -1 to disable)", gopon.SecStmCtlList[i], v)
+		}
+	}
+	for i, v := range sp.GetAppRateLimit() {
+		if v < -1 || v > 1000 {
+			return fmt.Errorf("App Rate Limit %s: %d is out of range (0...1000, or -1 to disable)", gopon.SecArlList[i], v)
+		}
+	}
+	return nil
+}
+
+// presetDir returns the directory holding the presets of a kind, creating it and calling seed to write the defaults if it does not exist
+func presetDir(kind string, seed func(dir string) error) (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, "ponpro", "presets", kind)
+	if _, err = os.Stat(dir); err == nil {
+		return dir, nil
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	err = seed(dir)
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("++ Created the default %s presets in %s\n", kind, dir)
+	return dir, nil
+}
+
+func securityPresetDir() (string, error) {
+	return presetDir("security", func(dir string) error {
+		for _, p := range defaultSecurityPresets() {
+			err := saveSecurityPreset(dir, p)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func saveSecurityPreset(dir string, p *securityPreset) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, p.Name+".json"), append(data, '\n'), 0644)
+}
+
+// getSecurityPresets reads every preset file in the directory, sorted by name
+func getSecurityPresets(dir string) ([]*securityPreset, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var list []*securityPreset
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var p securityPreset
+		err = json.Unmarshal(data, &p)
+		if err == nil {
+			err = p.validate()
+		}
+		if err != nil {
+			fmt.Printf("!! Skipping Security Preset %s: %v\n", f, err)
+			continue
+		}
+		p.Name = strings.TrimSuffix(filepath.Base(f), ".json")
+		list = append(list, &p)
+	}
+	return list, nil
+}
+
+func tabwriteSecurityPresets(list []*securityPreset) {
+	var rows [][]string
+	for _, p := range list {
+		sp := &p.Profile
+		rows = append(rows, []string{
+			p.Name,
+			p.Description,
+			fmt.Sprintf("%v", sp.GetProtectedPort()),
+			fmt.Sprintf("%v", sp.GetMacSG()),
+			fmt.Sprintf("%d", sp.MacLimit),
+			fmt.Sprintf("%v", sp.GetPortSecurity()),
+			fmt.Sprintf("%v", sp.GetArpInspect()),
+			fmt.Sprintf("%v", sp.GetIPv4SG()),
+			fmt.Sprintf("%v", sp.GetIPv6SG()),
+			fmt.Sprintf("%v", sp.GetStormControl()),
+			fmt.Sprintf("%v", sp.GetAppRateLimit()),
+		})
+	}
+	tabwriteTable("Security Presets", SecurityPresetHeaders, rows)
+}
+
+func securityPresetHandler(olt *gopon.LumiaOlt) error {
+	dir, err := securityPresetDir()
+	if err != nil {
+		return err
+	}
+	list, err := getSecurityPresets(dir)
+	if err != nil {
+		return err
+	}
+	tabwriteSecurityPresets(list)
+	fmt.Println(">> What would you like to do?")
+	printList(SecurityPresetOperations)
+	fmt.Print(">> ")
+	arg := strings.ToLower(sanitizeInput(readFromStdin()))
+	switch getIntFromArg(arg, SecurityPresetOperations) {
+	case 0:
+		return applySecurityPreset(olt, list)
+	case 1:
+		return saveSecurityProfileAsPreset(olt, dir)
+	default:
+		return gopon.ErrNotInput
+	}
+}
+
+// applySecurityPreset creates a Security Profile from the preset, or overwrites one that is not in use
+func applySecurityPreset(olt *gopon.LumiaOlt, list []*securityPreset) error {
+	fmt.Print(">> Which Preset would you like to apply?\n>> ")
+	name := sanitizeInput(readFromStdin())
+	var preset *securityPreset
+	for _, p := range list {
+		if p.Name == name {
+			preset = p
+		}
+	}
+	if preset == nil {
+		return gopon.ErrNotExists
+	}
+	fmt.Print(">> Provide the name of the Security Profile to create or overwrite\n>> ")
+	secpName := sanitizeInput(readFromStdin())
+	if secpName == "" {
+		return gopon.ErrNotInput
+	}
+	secp := preset.Profile
+	secp.Name = secpName
+	secp.Usage = 2
+	existing, err := olt.GetSecurityProfileByName(secpName)
+	if err == nil {
+		if existing.IsUsed() {
+			fmt.Println("!! Cannot overwrite in-use profile, apply the Preset to a new name and assign it to the Service Profiles instead")
+			return nil
+		}
+		fmt.Printf(">> Security Profile %s exists, overwrite it? (y/N)\n>> ", secpName)
+		input := strings.ToLower(sanitizeInput(readFromStdin()))
+		if input != "y" {
+			return nil
+		}
+		err = olt.DeleteSecurityProfile(secpName)
+		if err != nil {
+			return err
+		}
+	} else if err != gopon.ErrNotExists {
+		return err
+	}
+	secp.Tabwrite()
+	return olt.PostSecurityProfile(secp.GenerateJson())
+}
+
+// saveSecurityProfileAsPreset writes an existing Security Profile to the preset directory
+func saveSecurityProfileAsPreset(olt *gopon.LumiaOlt, dir string) error {
+	err := displaySecurityProfiles(olt)
+	if err != nil {
+		return err
+	}
+	fmt.Print(">> Which Security Profile would you like to save as a Preset?\n>> ")
+	secp, err := olt.GetSecurityProfileByName(sanitizeInput(readFromStdin()))
+	if err != nil {
+		return err
+	}
+	p := &securityPreset{Profile: *secp}
+	p.Profile.Name = ""
+	p.Profile.Usage = 0
+	err = p.validate()
+	if err != nil {
+		return fmt.Errorf("Security Profile %s cannot be a Preset: %v", secp.Name, err)
+	}
+	fmt.Print(">> Provide the name of the new Preset\n>> ")
+	p.Name = sanitizeInput(readFromStdin())
+	if p.Name == "" {
+		return gopon.ErrNotInput
+	}
+	if _, err = os.Stat(filepath.Join(dir, p.Name+".json")); err == nil {
+		fmt.Printf(">> Preset %s exists, overwrite it? (y/N)\n>> ", p.Name)
+		input := strings.ToLower(sanitizeInput(readFromStdin()))
+		if input != "y" {
+			return nil
+		}
+	}
+	fmt.Print(">> Provide a description of the Preset\n>> ")
+	p.Description = strings.TrimSpace(readFromStdin())
+	err = saveSecurityPreset(dir, p)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("++ Saved Security Preset %s in %s\n", p.Name, dir)
+	return nil
+}
@@ -15,7 +15,11 @@ func displaySecurityProfiles(olt *gopon.LumiaOlt) error {
 	if err != nil {
 		return err
 	}
-	secpl.Tabwrite()
+	l := newProfileListing("security", "Security Profile List", gopon.SecurityProfileHeaders)
+	for _, secp := range secpl.Entry {
+		l.addParams(secp.Name, secp.Usage, secp.ListEssentialParams())
+	}
+	tabwriteListing(l)
 	return nil
 }
 
@@ -185,22 +189,20 @@ func modifySecurityProfileHandler(olt *gopon.LumiaOlt, secp *gopon.SecurityProfi
 		fmt.Printf(">> Current value is [%v], modify configuration? (Y/n)\n>> ", secp.GetStormControlString())
 		togBool := strings.ToLower(sanitizeInput(readFromStdin()))
 		if togBool == "y" || togBool == "" {
-			arg := getArgFromSelection(gopon.SecStmCtlList)
-			modVal := getIntFromArg(arg, gopon.SecStmCtlList)
-			secp, err = modifyStormControlParameters(secp, modVal)
+			tabwriteRateLimits(secp, nil)
+			secp, err = modifyRateLimits(secp, false)
 			if err != nil {
 				return nil, err
 			}
 		}
 	case 9:
 		// AppRateLimit
-		fmt.Println("++ ")
+		fmt.Println("++ Application Rate Limit is a max data rate in Packets Per Second (pps) from (0...1000) of the DHCP, IGMP, PPPoE, STP and Management Network (MN) packets on a port, where a value of -1 is disabled")
 		fmt.Printf(">> Current value is [%v], modify configuration? (Y/n)\n>> ", secp.GetAppRateLimitString())
 		togBool := strings.ToLower(sanitizeInput(readFromStdin()))
 		if togBool == "y" || togBool == "" {
-			arg := getArgFromSelection(gopon.SecArlList)
-			modVal := getIntFromArg(arg, gopon.SecArlList)
-			secp, err = modifyARLParameters(secp, modVal)
+			tabwriteRateLimits(secp, nil)
+			secp, err = modifyRateLimits(secp, true)
 			if err != nil {
 				return nil, err
 			}
@@ -291,146 +293,122 @@ func modifyIpSgParameters(secp *gopon.SecurityProfile, modVal int) (*gopon.Secur
 	return secp, nil
 }
 
-// a composite value expressed as BUM: Broadcast, Unknown-Unicast, Multicast
-func modifyStormControlParameters(secp *gopon.SecurityProfile, modVal int) (*gopon.SecurityProfile, error) {
-	switch modVal {
-	case 0:
-		// Broadcast
-		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", secp.StormControlBroadcast)
-		newInt := sanitizeInput(readFromStdin())
-		if newInt != "" {
-			l, err := strconv.Atoi(newInt)
-			if err != nil {
-				return nil, gopon.ErrNotInput
-			}
-			if l >= 0 && l < 65536 {
-				secp.StormControlBroadcast = l
-			} else {
-				secp.StormControlBroadcast = -1
-			}
+// stormControlKeys map the names accepted on the composite input to the order of gopon.SecStmCtlList (BUM)
+var stormControlKeys = map[string]int{
+	"bcast":     0,
+	"broadcast": 0,
+	"unknown":   1,
+	"ucast":     1,
+	"unicast":   1,
+	"mcast":     2,
+	"multicast": 2,
+}
+
+// arlKeys map the names accepted on the composite input to the order of gopon.SecArlList
+var arlKeys = map[string]int{
+	"dhcp":  0,
+	"igmp":  1,
+	"pppoe": 2,
+	"stp":   3,
+	"mn":    4,
+}
+
+// parseCompositeValues applies a line such as `bcast=500 mcast=1000 unknown=-1` to a copy of current,
+// each value must be within min...max or -1 to disable, keys not given keep their value
+func parseCompositeValues(input string, keys map[string]int, current []int, min, max int) ([]int, error) {
+	values := make([]int, len(current))
+	copy(values, current)
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return values, gopon.ErrNotInput
+	}
+	for _, f := range fields {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return current, fmt.Errorf("expected key=value, got %q", f)
 		}
-	case 1:
-		// Unknown-Unicast
-		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", secp.StormControlUnicast)
-		newInt := sanitizeInput(readFromStdin())
-		if newInt != "" {
-			l, err := strconv.Atoi(newInt)
-			if err != nil {
-				return nil, gopon.ErrNotInput
-			}
-			if l >= 0 && l < 65536 {
-				secp.StormControlUnicast = l
-			} else {
-				secp.StormControlUnicast = -1
-			}
+		i, ok := keys[strings.ToLower(kv[0])]
+		if !ok {
+			return current, fmt.Errorf("unknown key %q", kv[0])
 		}
-	case 2:
-		// Multicast
-		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", secp.StormControlMulticast)
-		newInt := sanitizeInput(readFromStdin())
-		if newInt != "" {
-			l, err := strconv.Atoi(newInt)
-			if err != nil {
-				return nil, gopon.ErrNotInput
-			}
-			if l >= 0 && l < 65536 {
-				secp.StormControlMulticast = l
-			} else {
-				secp.StormControlMulticast = -1
-			}
+		v, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return current, fmt.Errorf("%s: %q is not a number", kv[0], kv[1])
 		}
-	default:
-		fmt.Println("!! Unpexpected input, nothing to modify")
+		if v != -1 && (v < min || v > max) {
+			return current, fmt.Errorf("%s: %d is out of range (%d...%d, or -1 to disable)", kv[0], v, min, max)
+		}
+		values[i] = v
 	}
-	return secp, nil
+	return values, nil
 }
 
-// a composite value expressed as an ordered 5-int list of Applications and their Rate limits
-func modifyARLParameters(secp *gopon.SecurityProfile, modVal int) (*gopon.SecurityProfile, error) {
-	switch modVal {
-	case 0:
-		// DHCP
-		fmt.Println("++ Max data rate (pps) of DHCP (Dynamic Host Configuration Protocol) packets on a port (0...1000), where -1 disables the Rate-limiting functionality")
-		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", secp.AppRateLimitDhcp)
-		newInt := sanitizeInput(readFromStdin())
-		if newInt != "" {
-			l, err := strconv.Atoi(newInt)
-			if err != nil {
-				return nil, gopon.ErrNotInput
-			}
-			if l >= 0 && l < 1001 {
-				secp.AppRateLimitDhcp = l
-			} else {
-				secp.AppRateLimitDhcp = -1
-			}
-		}
-	case 1:
-		// IGMP
-		fmt.Println("++ Max data rate (pps) of IGMP (Internet Group Messaging Protocol) packets on a port (0...1000), where -1 disables the Rate-limiting functionality")
-		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", secp.AppRateLimitIgmp)
-		newInt := sanitizeInput(readFromStdin())
-		if newInt != "" {
-			l, err := strconv.Atoi(newInt)
-			if err != nil {
-				return nil, gopon.ErrNotInput
-			}
-			if l >= 0 && l < 1001 {
-				secp.AppRateLimitIgmp = l
-			} else {
-				secp.AppRateLimitIgmp = -1
-			}
+func rateLimitString(v int) string {
+	if v == -1 {
+		return "Disabled"
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+// tabwriteRateLimits shows the BUM and ARL tuples side by side, before and after the change when after is not nil
+func tabwriteRateLimits(before, after *gopon.SecurityProfile) {
+	headers := []string{""}
+	headers = append(headers, gopon.SecStmCtlList...)
+	headers = append(headers, gopon.SecArlList...)
+	list := []*gopon.SecurityProfile{before}
+	labels := []string{"Current"}
+	if after != nil {
+		list = append(list, after)
+		labels = []string{"Before", "After"}
+	}
+	var rows [][]string
+	for i, secp := range list {
+		row := []string{labels[i]}
+		for _, v := range append(secp.GetStormControl(), secp.GetAppRateLimit()...) {
+			row = append(row, rateLimitString(v))
 		}
-	case 2:
-		// PPPOE
-		fmt.Println("++ Max data rate (pps) of PPPOE (Point-to-Point Protocol Over Ethernet) packets on a port (0...1000), where -1 disables the Rate-limiting functionality")
-		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", secp.AppRateLimitPppoe)
-		newInt := sanitizeInput(readFromStdin())
-		if newInt != "" {
-			l, err := strconv.Atoi(newInt)
-			if err != nil {
-				return nil, gopon.ErrNotInput
+		rows = append(rows, row)
+	}
+	tabwriteTable("Storm Control (pps) and Application Rate Limits (pps)", headers, rows)
+}
+
+// modifyRateLimits takes the composite storm control or ARL input in one line, repeating the prompt until it is valid or empty
+func modifyRateLimits(secp *gopon.SecurityProfile, arl bool) (*gopon.SecurityProfile, error) {
+	before := *secp
+	for {
+		var err error
+		if arl {
+			fmt.Print(">> Provide the new rate limits, for example: dhcp=50 igmp=100 pppoe=50 stp=10 mn=-1\n>> ")
+			input := strings.TrimSpace(readFromStdin())
+			if input == "" {
+				return secp, nil
 			}
-			if l >= 0 && l < 1001 {
-				secp.AppRateLimitPppoe = l
-			} else {
-				secp.AppRateLimitPppoe = -1
+			var values []int
+			values, err = parseCompositeValues(input, arlKeys, secp.GetAppRateLimit(), 0, 1000)
+			if err == nil {
+				for i, v := range values {
+					secp.SetARL(i, v)
+				}
 			}
-		}
-	case 3:
-		// STP
-		fmt.Println("++ Max data rate (pps) of STP (Spanning Tree Protocol) packets on a port (0...1000), where -1 disables the Rate-limiting functionality")
-		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", secp.AppRateLimitStp)
-		newInt := sanitizeInput(readFromStdin())
-		if newInt != "" {
-			l, err := strconv.Atoi(newInt)
-			if err != nil {
-				return nil, gopon.ErrNotInput
+		} else {
+			fmt.Print(">> Provide the new limits, for example: bcast=500 mcast=1000 unknown=-1\n>> ")
+			input := strings.TrimSpace(readFromStdin())
+			if input == "" {
+				return secp, nil
 			}
-			if l >= 0 && l < 1001 {
-				secp.AppRateLimitStp = l
-			} else {
-				secp.AppRateLimitStp = -1
+			var values []int
+			values, err = parseCompositeValues(input, stormControlKeys, secp.GetStormControl(), 0, 65535)
+			if err == nil {
+				secp.SetStormControl(values)
 			}
 		}
-	case 4:
-		// MN
-		fmt.Println("++ Max data rate (pps) of MN (Management Network) packets on a port (0...1000), where -1 disables the Rate-limiting functionality")
-		fmt.Printf(">> Current value is [%v], provide new value:\n>> ", secp.AppRateLimitStp)
-		newInt := sanitizeInput(readFromStdin())
-		if newInt != "" {
-			l, err := strconv.Atoi(newInt)
-			if err != nil {
-				return nil, gopon.ErrNotInput
-			}
-			if l >= 0 && l < 1001 {
-				secp.AppRateLimitStp = l
-			} else {
-				secp.AppRateLimitStp = -1
-			}
+		if err != nil {
+			fmt.Printf("!! %v, nothing set\n", err)
+			continue
 		}
-	default:
-		fmt.Println("!! Unpexpected input, nothing to modify")
+		tabwriteRateLimits(&before, secp)
+		return secp, nil
 	}
-	
-	return secp, nil
 }
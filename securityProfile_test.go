@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lindsaybb/gopon"
+)
+
+func TestParseCompositeValues(t *testing.T) {
+	current := []int{100, 200, 300}
+	tests := []struct {
+		name    string
+		input   string
+		keys    map[string]int
+		max     int
+		want    []int
+		wantErr bool
+	}{
+		{"all keys", "bcast=500 mcast=1000 unknown=-1", stormControlKeys, 65535, []int{500, -1, 1000}, false},
+		{"commas and aliases", "broadcast=1,Unicast=2,multicast=3", stormControlKeys, 65535, []int{1, 2, 3}, false},
+		{"keys not given keep their value", "mcast=0", stormControlKeys, 65535, []int{100, 200, 0}, false},
+		{"arl key", "igmp=50", arlKeys, 1000, []int{100, 50, 300}, false},
+		{"not key=value", "bcast", stormControlKeys, 65535, current, true},
+		{"unknown key", "anycast=5", stormControlKeys, 65535, current, true},
+		{"not a number", "bcast=lots", stormControlKeys, 65535, current, true},
+		{"above max", "dhcp=1001", arlKeys, 1000, current, true},
+		{"below -1", "bcast=-2", stormControlKeys, 65535, current, true},
+		{"error keeps earlier keys out", "bcast=5 mcast=x", stormControlKeys, 65535, current, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCompositeValues(tt.input, tt.keys, current, 0, tt.max)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseCompositeValuesEmpty(t *testing.T) {
+	current := []int{1, 2, 3}
+	got, err := parseCompositeValues("  ", stormControlKeys, current, 0, 65535)
+	if err != gopon.ErrNotInput {
+		t.Errorf("err = %v, want %v", err, gopon.ErrNotInput)
+	}
+	if !reflect.DeepEqual(got, current) {
+		t.Errorf("got %v, want %v", got, current)
+	}
+	got[0] = 9
+	if current[0] != 1 {
+		t.Errorf("the current values were modified")
+	}
+}
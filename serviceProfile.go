@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"strconv"
@@ -8,6 +9,11 @@ import (
 	"github.com/lindsaybb/gopon"
 )
 
+const (
+	serviceProfileTable = "msanServiceProfileTable"
+	serviceProfileEntry = "msanServiceProfileEntry"
+)
+
 func displayServiceProfiles(olt *gopon.LumiaOlt) error {
 	// the top level data structure for provisioning services on an OLT is represented by a "Service Profile"
 	// we will perform a GET Request to retrieve all currently configured Service Profiles on the OLT
@@ -18,10 +24,19 @@ func displayServiceProfiles(olt *gopon.LumiaOlt) error {
 	if err != nil {
 		return err
 	}
-	spl.TabwriteFull()
+	tabwriteServiceProfiles(spl)
 	return nil
 }
 
+// tabwriteServiceProfiles lists every Service Profile with its sub-profiles
+func tabwriteServiceProfiles(spl *gopon.ServiceProfileList) {
+	l := newProfileListing("service", "Service Profile List", gopon.ServiceProfileHeaders)
+	for _, sp := range spl.Entry {
+		l.addParams(sp.Name, sp.Usage, sp.ListSubProfiles())
+	}
+	tabwriteListing(l)
+}
+
 func modifyServiceProfiles(olt *gopon.LumiaOlt, arg string) error {
 
 	var err error
@@ -30,7 +45,7 @@ func modifyServiceProfiles(olt *gopon.LumiaOlt, arg string) error {
 	if err != nil {
 		return err
 	}
-	spl.TabwriteFull()
+	tabwriteServiceProfiles(spl)
 
 	fmt.Print(">> Which Service Profile would you like to Modify?\n>> ")
 	spName := sanitizeInput(readFromStdin())
@@ -42,6 +57,12 @@ func modifyServiceProfiles(olt *gopon.LumiaOlt, arg string) error {
 	if err != nil {
 		return err
 	}
+	origName := sp.Name
+	var columns reportedColumns
+	columns, err = getServiceProfileColumns(olt, origName)
+	if err != nil {
+		return err
+	}
 	fmt.Print(">> Would you like to delete this profile? (y/N)\n>> ")
 	input := strings.ToLower(sanitizeInput(readFromStdin()))
 	if input == "y" {
@@ -57,7 +78,7 @@ func modifyServiceProfiles(olt *gopon.LumiaOlt, arg string) error {
 			fmt.Print(">> Would you like to copy this Profile to a new name to be able to modify it? (y/N)\n>> ")
 			rnBool := strings.ToLower(sanitizeInput(readFromStdin()))
 			if rnBool == "y" {
-				sp, err = modifyServiceProfileHandler(olt, sp, 0)
+				sp, err = modifyServiceProfileHandler(olt, sp, columns, 0)
 				if err != nil {
 					return err
 				}
@@ -70,7 +91,7 @@ func modifyServiceProfiles(olt *gopon.LumiaOlt, arg string) error {
 	}
 	if sp.IsUsed() {
 		fmt.Println("!! Cannot modify in-use profile")
-		sp, err = modifyServiceProfileHandler(olt, sp, 0)
+		sp, err = modifyServiceProfileHandler(olt, sp, columns, 0)
 		if err != nil {
 			return err
 		}
@@ -80,7 +101,7 @@ func modifyServiceProfiles(olt *gopon.LumiaOlt, arg string) error {
 	}
 	for {
 		modVal := getIntFromArg(arg, gopon.ServiceProfileHeaders)
-		sp, err = modifyServiceProfileHandler(olt, sp, modVal)
+		sp, err = modifyServiceProfileHandler(olt, sp, columns, modVal)
 		if err != nil {
 			return err
 		}
@@ -97,6 +118,10 @@ func modifyServiceProfiles(olt *gopon.LumiaOlt, arg string) error {
 	fmt.Print(">> Post this modification? (Y/n)\n>> ")
 	postBool := strings.ToLower(sanitizeInput(readFromStdin()))
 	if postBool == "y" || postBool == "" {
+		err = checkServiceCollisions(olt, origName, sp)
+		if err != nil {
+			return err
+		}
 		err = olt.DeleteServiceProfile(sp.Name)
 		if err != nil {
 			// if the profile has been renamed it can't be deleted and this not 200 OK is expected
@@ -106,12 +131,36 @@ func modifyServiceProfiles(olt *gopon.LumiaOlt, arg string) error {
 				return err
 			}
 		}
-		return olt.PostServiceProfile(sp.GenerateJson())
+		name, data := sp.GenerateJson()
+		data, err = columns.merge(data)
+		if err != nil {
+			return err
+		}
+		return olt.PostServiceProfile(name, data)
 	}
 	return nil
 }
 
-func modifyServiceProfileHandler(olt *gopon.LumiaOlt, sp *gopon.ServiceProfile, modVal int) (*gopon.ServiceProfile, error) {
+// getServiceProfileColumns reads the columns gopon does not model from the raw entry of the Service Profile
+func getServiceProfileColumns(olt *gopon.LumiaOlt, name string) (reportedColumns, error) {
+	entries, err := getRawTableEntries(olt, serviceProfileTable, serviceProfileEntry)
+	if err != nil {
+		return nil, err
+	}
+	for _, raw := range entries {
+		var sp gopon.ServiceProfile
+		err = json.Unmarshal(raw, &sp)
+		if err != nil {
+			return nil, err
+		}
+		if sp.Name == name {
+			return findReportedColumns(raw, sp, pppoeIaColumns)
+		}
+	}
+	return nil, gopon.ErrNotExists
+}
+
+func modifyServiceProfileHandler(olt *gopon.LumiaOlt, sp *gopon.ServiceProfile, columns reportedColumns, modVal int) (*gopon.ServiceProfile, error) {
 	var err error
 	switch modVal {
 	case 0:
@@ -186,7 +235,21 @@ func modifyServiceProfileHandler(olt *gopon.LumiaOlt, sp *gopon.ServiceProfile,
 		}
 		sp.OnuTcontProfileName = otp.Name
 	case 5:
-		fmt.Println("!! ONU VLAN Profile to be implemented")
+		err = displayOnuVlanProfiles(olt)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Print(">> Which ONU VLAN Profile would you like to assign to the Service Profile instead?\n>> ")
+		newOvp := sanitizeInput(readFromStdin())
+		if newOvp == "" {
+			return nil, gopon.ErrNotInput
+		}
+		var ovp *gopon.OnuVlanProfile
+		ovp, err = olt.GetOnuVlanProfileByName(newOvp)
+		if err != nil {
+			return nil, err
+		}
+		sp.OnuVlanProfileName = ovp.Name
 	case 6:
 		fmt.Printf(">> Current Virtual GEM Port is [%d]. Enter the desired value:\n>> ", sp.OnuVirtGemPortID)
 		newVgem := sanitizeInput(readFromStdin())
@@ -211,17 +274,91 @@ func modifyServiceProfileHandler(olt *gopon.LumiaOlt, sp *gopon.ServiceProfile,
 		}
 		sp.OnuTpType = tp
 	case 8:
-		fmt.Println("!! Security Profile to be implemented")
+		err = displaySecurityProfiles(olt)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Print(">> Which Security Profile would you like to assign to the Service Profile instead, or none to remove it?\n>> ")
+		newSecp := sanitizeInput(readFromStdin())
+		if newSecp == "" {
+			return nil, gopon.ErrNotInput
+		}
+		if strings.ToLower(newSecp) == "none" {
+			sp.SecurityProfileName = ""
+			break
+		}
+		var secp *gopon.SecurityProfile
+		secp, err = olt.GetSecurityProfileByName(newSecp)
+		if err != nil {
+			return nil, err
+		}
+		sp.SecurityProfileName = secp.Name
 	case 9:
-		fmt.Println("!! IGMP Profile to be implemented")
+		err = displayIgmpProfiles(olt)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Print(">> Which IGMP Profile would you like to assign to the Service Profile instead, or none to remove it?\n>> ")
+		newIp := sanitizeInput(readFromStdin())
+		if newIp == "" {
+			return nil, gopon.ErrNotInput
+		}
+		if strings.ToLower(newIp) == "none" {
+			sp.MulticastProfileName = ""
+			break
+		}
+		var ip *gopon.IgmpProfile
+		ip, err = olt.GetMulticastProfileByName(newIp)
+		if err != nil {
+			return nil, err
+		}
+		sp.MulticastProfileName = ip.Name
 	case 10:
-		fmt.Println("!! ONU IGMP Profile to be implemented")
+		err = displayOnuIgmpProfiles(olt)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Print(">> Which ONU IGMP Profile would you like to assign to the Service Profile instead, or none to remove it?\n>> ")
+		newOip := sanitizeInput(readFromStdin())
+		if newOip == "" {
+			return nil, gopon.ErrNotInput
+		}
+		if strings.ToLower(newOip) == "none" {
+			sp.OnuMulticastProfileName = ""
+			break
+		}
+		var oip *gopon.OnuIgmpProfile
+		oip, err = olt.GetOnuMulticastProfileByName(newOip)
+		if err != nil {
+			return nil, err
+		}
+		sp.OnuMulticastProfileName = oip.Name
 	case 11:
-		fmt.Println("!! L2CP Profile to be implemented")
+		err = displayL2cpProfiles(olt)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Print(">> Which L2CP Profile would you like to assign to the Service Profile instead?\n>> ")
+		newLp := sanitizeInput(readFromStdin())
+		if newLp == "" {
+			return nil, gopon.ErrNotInput
+		}
+		var lp *l2cpProfile
+		lp, err = getL2cpProfileByName(olt, newLp)
+		if err != nil {
+			return nil, err
+		}
+		sp.L2cpProfileName = lp.Name
 	case 12:
-		fmt.Println("!! DHCP-RA Settings to be implemented")
+		sp, err = modifyDhcpRaSettings(olt, sp)
+		if err != nil {
+			return nil, err
+		}
 	case 13:
-		fmt.Println("!! PPPoE-IA Settings to be implemented")
+		sp, err = modifyPppoeIaSettings(olt, sp, columns)
+		if err != nil {
+			return nil, err
+		}
 	default:
 		fmt.Println("!! Unexpected value, no change made")
 	}
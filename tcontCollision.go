@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lindsaybb/gopon"
+)
+
+var errOnuCollision = errors.New("T-CONT ID or Virtual GEM Port collides with another service on the same ONU")
+
+// onuCollision is a T-CONT ID or Virtual GEM Port used by more than one Service Profile on the same ONU
+type onuCollision struct {
+	Interface    string
+	SerialNumber string
+	Kind         string
+	Value        int
+	Services     []string
+}
+
+var OnuCollisionHeaders = []string{
+	"Interface",
+	"Serial Number",
+	"Collision",
+	"Value",
+	"Service Profiles",
+}
+
+// findOnuCollisions groups the entries by ONU and reports any T-CONT ID or Virtual GEM Port shared by two or more services
+func findOnuCollisions(entries []*onuTcontEntry) []*onuCollision {
+	byOnu := make(map[string][]*onuTcontEntry)
+	var onus []string
+	for _, e := range entries {
+		if _, ok := byOnu[e.Interface]; !ok {
+			onus = append(onus, e.Interface)
+		}
+		byOnu[e.Interface] = append(byOnu[e.Interface], e)
+	}
+	sort.Strings(onus)
+	var list []*onuCollision
+	for _, intf := range onus {
+		tcontIDs := make(map[int][]string)
+		gemPorts := make(map[int][]string)
+		for _, e := range byOnu[intf] {
+			if e.Tcont != nil {
+				tcontIDs[e.Tcont.TcontID] = append(tcontIDs[e.Tcont.TcontID], e.Service)
+			}
+			gemPorts[e.VirtGemPort] = append(gemPorts[e.VirtGemPort], e.Service)
+		}
+		sn := byOnu[intf][0].SerialNumber
+		list = append(list, collectCollisions(intf, sn, "T-CONT ID", tcontIDs)...)
+		list = append(list, collectCollisions(intf, sn, "Virtual GEM Port", gemPorts)...)
+	}
+	return list
+}
+
+func collectCollisions(intf, sn, kind string, used map[int][]string) []*onuCollision {
+	var values []int
+	for v, services := range used {
+		if len(services) > 1 {
+			values = append(values, v)
+		}
+	}
+	sort.Ints(values)
+	var list []*onuCollision
+	for _, v := range values {
+		list = append(list, &onuCollision{
+			Interface:    intf,
+			SerialNumber: sn,
+			Kind:         kind,
+			Value:        v,
+			Services:     used[v],
+		})
+	}
+	return list
+}
+
+// key identifies the collision independent of which services are involved
+func (c *onuCollision) key() string {
+	return fmt.Sprintf("%s|%s|%d", c.Interface, c.Kind, c.Value)
+}
+
+func tabwriteOnuCollisions(list []*onuCollision) {
+	var rows [][]string
+	for _, c := range list {
+		rows = append(rows, []string{
+			c.Interface,
+			c.SerialNumber,
+			c.Kind,
+			fmt.Sprintf("%d", c.Value),
+			strings.Join(c.Services, ", "),
+		})
+	}
+	tabwriteTable("ONU Service Collisions", OnuCollisionHeaders, rows)
+}
+
+// reportNewCollisions prints any collision not already present in before and returns errOnuCollision if there are any
+func reportNewCollisions(before, after []*onuCollision) error {
+	existing := make(map[string]bool)
+	for _, c := range before {
+		existing[c.key()] = true
+	}
+	var found []*onuCollision
+	for _, c := range after {
+		if !existing[c.key()] {
+			found = append(found, c)
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	fmt.Println("!! The following ONUs would have colliding services:")
+	tabwriteOnuCollisions(found)
+	return errOnuCollision
+}
+
+// checkTcontCollisions blocks a T-CONT Profile edit whose T-CONT ID collides on any ONU using the profile origName
+func checkTcontCollisions(olt *gopon.LumiaOlt, origName string, otp *gopon.OnuTcontProfile) error {
+	if otp.Name != origName {
+		// a renamed profile is posted as a new copy, no service references it yet
+		return nil
+	}
+	// same re-use of the T-CONT table as checkTcontBudget, restore the edits after gathering
+	edited := *otp
+	entries, _, err := getOnuTcontUsage(olt)
+	*otp = edited
+	if err != nil {
+		return err
+	}
+	before := findOnuCollisions(entries)
+	for _, e := range entries {
+		if e.Tcont != nil && e.Tcont.Name == origName {
+			e.Tcont = &edited
+		}
+	}
+	return reportNewCollisions(before, findOnuCollisions(entries))
+}
+
+// checkServiceCollisions blocks a Service Profile edit whose T-CONT ID or Virtual GEM Port collides on any ONU using the profile origName
+func checkServiceCollisions(olt *gopon.LumiaOlt, origName string, sp *gopon.ServiceProfile) error {
+	if sp.Name != origName {
+		// a renamed profile is posted as a new copy, no ONU is assigned it yet
+		return nil
+	}
+	// fetching the Service Profile table re-uses the memory the edited profile points into
+	edited := *sp
+	entries, tconts, err := getOnuTcontUsage(olt)
+	*sp = edited
+	if err != nil {
+		return err
+	}
+	before := findOnuCollisions(entries)
+	for _, e := range entries {
+		if e.Service == origName {
+			e.VirtGemPort = edited.OnuVirtGemPortID
+			e.Tcont = tconts[edited.OnuTcontProfileName]
+		}
+	}
+	return reportNewCollisions(before, findOnuCollisions(entries))
+}
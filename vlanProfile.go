@@ -15,7 +15,11 @@ func displayVlanProfiles(olt *gopon.LumiaOlt) error {
 	if err != nil {
 		return err
 	}
-	vpl.Tabwrite()
+	l := newProfileListing("vlan", "VLAN Profile List", gopon.VlanProfileHeaders)
+	for _, vp := range vpl.Entry {
+		l.addParams(vp.Name, vp.Usage, vp.ListEssentialParams())
+	}
+	tabwriteListing(l)
 	return nil
 }
 